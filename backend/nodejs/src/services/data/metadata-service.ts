@@ -10,6 +10,7 @@ export enum MetadataPath {
     STREAM = 'validation.stream',
     TECHNICAL = 'metadata.technical',
     QUALITY = 'metadata.quality',
+    QUALITY_GATE = 'metadata.qualityGate',
     DISTRIBUTION = 'metadata.distribution'
 }
 
@@ -25,9 +26,12 @@ export enum ProcessingStage {
     Validation = 'validation',
     Metadata = 'metadata',
     Accepted = 'accepted',
+    Dispatch = 'dispatch',
     Download = 'download',
     WriteToStorage = 'writeToStorage',
     InitializeProcessor = 'initializeProcessor',
+    QualityGate = 'qualityGate',
+    Fingerprint = 'fingerprint',
     GenerateThumbnail = 'generateThumbnail',
     GenerateMP4Files = 'generateMP4Files',
     GenerateHLSPlaylists = 'generateHLSPlaylists',
@@ -134,6 +138,7 @@ const UPDATE_PATHS: Record<MetadataPath, string[]> = {
     [MetadataPath.STREAM]: ['metadata', 'validation', 'stream'],
     [MetadataPath.TECHNICAL]: ['metadata', 'technical'],
     [MetadataPath.QUALITY]: ['metadata', 'quality'],
+    [MetadataPath.QUALITY_GATE]: ['metadata', 'qualityGate'],
     [MetadataPath.DISTRIBUTION]: ['metadata', 'distribution'],
 };
 
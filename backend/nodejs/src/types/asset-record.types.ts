@@ -34,6 +34,7 @@ export const createInitialRecord = (userId: string, assetId: string): AssetRecor
             },
             technical: { M: {} },
             quality: { M: {} },
+            qualityGate: { M: {} },
             distribution: { M: {} },
         },
     },
@@ -51,6 +52,9 @@ export const createInitialRecord = (userId: string, assetId: string): AssetRecor
             accepted: {
                 M: { },
             },
+            dispatch: {
+                M: { },
+            },
             download: {
                 M: { },
             },
@@ -60,6 +64,12 @@ export const createInitialRecord = (userId: string, assetId: string): AssetRecor
             initializeProcessor: {
                 M: { },
             },
+            qualityGate: {
+                M: { },
+            },
+            fingerprint: {
+                M: { },
+            },
             generateThumbnail: {
                 M: { },
             },
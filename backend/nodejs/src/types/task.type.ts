@@ -1,6 +1,10 @@
 export enum TaskType {
     TRANSCODE = 'TRANSCODE',
-    VALIDATION = 'VALIDATION'
+    VALIDATION = 'VALIDATION',
+    THUMBNAIL = 'THUMBNAIL',
+    REPACKAGE = 'REPACKAGE',
+    AUDIO_EXTRACT = 'AUDIO_EXTRACT',
+    DELETE_OUTPUTS = 'DELETE_OUTPUTS'
 }
 
 export enum WorkerType {
@@ -13,6 +17,64 @@ export interface Location {
     Key?: string;
 }
 
+export enum LoudnessTarget {
+    MOBILE = 'mobile',
+    BROADCAST = 'broadcast'
+}
+
+export enum EncryptionMethod {
+    AES_128 = 'AES-128',
+    SAMPLE_AES = 'SAMPLE-AES'
+}
+
+export enum DrmScheme {
+    CENC = 'cenc',
+    CBCS = 'cbcs'
+}
+
+export interface CaptionInput {
+    key: string;
+    language: string;
+    label?: string;
+    offset?: number;
+}
+
+export interface WatermarkInput {
+    key: string;
+    position?: 'top-left' | 'top-right' | 'bottom-left' | 'bottom-right' | 'center';
+    margin?: number;
+    opacity?: number;
+    scale?: number;
+    start?: number;
+    end?: number;
+}
+
+export interface TrimRange {
+    start: number;
+    end?: number;
+}
+
+export enum TransitionType {
+    NONE = 'none',
+    CROSSFADE = 'crossfade',
+}
+
+export interface TransitionInput {
+    type: TransitionType;
+    duration?: number;
+}
+
+export enum VerticalMode {
+    CENTER = 'center',
+    SMART = 'smart',
+    FILL = 'fill',
+}
+
+export enum HlsLayout {
+    SEGMENTED = 'segmented',
+    SINGLE_FILE = 'single_file',
+}
+
 export interface Task {
     taskId: string;
     userId: string;
@@ -22,4 +84,23 @@ export interface Task {
     type: TaskType;
     worker: WorkerType;
     createdAt: string;
+    loudnessTarget?: LoudnessTarget;
+    captions?: CaptionInput[];
+    encryption?: EncryptionMethod;
+    drm?: DrmScheme;
+    watermark?: WatermarkInput;
+    startTime?: number;
+    endTime?: number;
+    ranges?: TrimRange[];
+    inputKeys?: string[];
+    transition?: TransitionInput;
+    // 'auto', 'off' or a manual 'width:height:x:y' rectangle.
+    crop?: string;
+    frameRate?: number;
+    vertical?: VerticalMode;
+    alignToScenes?: boolean;
+    hlsLayout?: HlsLayout;
+    lowLatency?: boolean;
+    chunks?: number;
+    profile?: string;
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "log"
+    "os"
+    "path/filepath"
+    "runtime"
+    "strings"
+    "time"
+
+    "github.com/pkalsi97/ShortRelay/backend/workers/processor/internal/transcoder"
+)
+
+// encodebench times the MP4 stage of the processor in each encode mode on the
+// current machine, to find where SINGLE_DECODE_MIN_CPUS should sit.
+func main() {
+    input := flag.String("input", "", "source video to encode")
+    modes := flag.String("modes", transcoder.EncodeModeSequential+","+transcoder.EncodeModeSingleDecode, "comma-separated encode modes")
+    runs := flag.Int("runs", 1, "runs per mode")
+    workDir := flag.String("workdir", os.TempDir(), "scratch directory for outputs")
+    flag.Parse()
+
+    if *input == "" {
+        log.Fatal("missing -input")
+    }
+    source, err := filepath.Abs(*input)
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    log.Printf("CPUs: %d, auto selects %s at %d or more by default", runtime.NumCPU(), transcoder.EncodeModeSingleDecode, transcoder.SingleDecodeMinCPUs)
+
+    results := make(map[string]time.Duration)
+    var duration float64
+    for _, mode := range strings.Split(*modes, ",") {
+        mode = strings.TrimSpace(mode)
+        if _, err := transcoder.ParseEncodeMode(mode); err != nil {
+            log.Fatal(err)
+        }
+
+        var total time.Duration
+        for run := 0; run < *runs; run++ {
+            elapsed, seconds, err := benchmark(source, mode, *workDir)
+            if err != nil {
+                log.Fatalf("%s run %d failed: %v", mode, run+1, err)
+            }
+            log.Printf("%s run %d: %s", mode, run+1, elapsed.Round(time.Millisecond))
+            total += elapsed
+            duration = seconds
+        }
+        results[mode] = total / time.Duration(*runs)
+    }
+
+    fmt.Printf("%-14s %12s %8s\n", "mode", "mean", "speed")
+    for _, mode := range strings.Split(*modes, ",") {
+        mode = strings.TrimSpace(mode)
+        elapsed := results[mode]
+        fmt.Printf("%-14s %12s %7.2fx\n", mode, elapsed.Round(time.Millisecond), duration/elapsed.Seconds())
+    }
+}
+
+// benchmark runs one encode in a fresh directory. The source is linked rather
+// than copied, since the processor writes next to its input.
+func benchmark(source, mode, workDir string) (time.Duration, float64, error) {
+    dir, err := os.MkdirTemp(workDir, "encodebench-")
+    if err != nil {
+        return 0, 0, err
+    }
+    defer os.RemoveAll(dir)
+
+    input := filepath.Join(dir, "input"+filepath.Ext(source))
+    if err := os.Symlink(source, input); err != nil {
+        return 0, 0, err
+    }
+
+    processor, err := transcoder.NewProcessor(input, transcoder.DefaultLadder, &transcoder.ProcessorConfig{EncodeMode: mode})
+    if err != nil {
+        return 0, 0, err
+    }
+
+    start := time.Now()
+    if err := processor.GenerateMP4Files(); err != nil {
+        return 0, 0, err
+    }
+    return time.Since(start), processor.VideoInfo.Duration, nil
+}
\ No newline at end of file
@@ -0,0 +1,314 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "os"
+    "path"
+    "path/filepath"
+    "runtime"
+    "strings"
+
+    "github.com/pkalsi97/ShortRelay/backend/workers/processor/internal/storage/s3"
+    "github.com/pkalsi97/ShortRelay/backend/workers/processor/internal/transcoder"
+    "github.com/pkalsi97/ShortRelay/backend/workers/processor/internal/storage/dynamodb"
+)
+
+const (
+    TaskTypeTranscode     = "TRANSCODE"
+    TaskTypeThumbnail     = "THUMBNAIL"
+    TaskTypeRepackage     = "REPACKAGE"
+    TaskTypeAudioExtract  = "AUDIO_EXTRACT"
+    TaskTypeDeleteOutputs = "DELETE_OUTPUTS"
+)
+
+// taskHandler runs one kind of task. The work directory is removed once the
+// handler returns.
+type taskHandler func(ctx context.Context, task Task, config *Config, updater *db.ProgressUpdater, workDir string) error
+
+var taskHandlers = map[string]taskHandler{
+    TaskTypeTranscode:     transcodeTask,
+    TaskTypeThumbnail:     thumbnailTask,
+    TaskTypeRepackage:     repackageTask,
+    TaskTypeAudioExtract:  audioExtractTask,
+    TaskTypeDeleteOutputs: deleteOutputsTask,
+}
+
+func processTask(ctx context.Context, task Task, config *Config) error {
+    workDir := filepath.Join(config.FootageDir, task.UserID, task.AssetID)
+    defer os.RemoveAll(workDir)
+
+    swm := NewStopWatch(fmt.Sprintf("Overall-Task-%s", task.TaskID))
+    defer swm.Stop()
+
+    // Initialize progress updater
+    updater, err := db.NewProgressUpdater(config.AWSRegion, config.MetadataTable, task.UserID, task.AssetID)
+    if err != nil {
+        return fmt.Errorf("failed to create progress updater: %v", err)
+    }
+
+    // Tasks without a type predate dispatch and were always transcodes.
+    taskType := task.Type
+    if taskType == "" {
+        taskType = TaskTypeTranscode
+    }
+    handler, ok := taskHandlers[taskType]
+    if !ok {
+        // The rejection gets its own stage, so it is not mistaken for a
+        // failure of the pipeline.
+        err := fmt.Errorf("unsupported task type %q for worker %s", task.Type, task.Worker)
+        if updateErr := updater.RejectTask(ctx, task.Type, task.Worker, err.Error()); updateErr != nil {
+            log.Printf("Failed to update dispatch state: %v", updateErr)
+        }
+        return err
+    }
+
+    log.Printf("Running %s task %s", taskType, task.TaskID)
+    return handler(ctx, task, config, updater, workDir)
+}
+
+// thumbnailTask regenerates the thumbnail, chapters and preview of an
+// existing asset.
+func thumbnailTask(ctx context.Context, task Task, config *Config, updater *db.ProgressUpdater, workDir string) error {
+    s3client, clips, err := downloadInputs(ctx, updater, task, config, workDir)
+    if err != nil {
+        return err
+    }
+    processor, _, err := initializeProcessor(ctx, updater, task, config, s3client, workDir, clips)
+    if err != nil {
+        return err
+    }
+
+    sw := NewStopWatch("GenerateThumbnail")
+    if err := processor.GenerateThumbnail(); err != nil {
+        updateState(ctx, updater, db.StateGenerateThumbnail, db.StateUploadTranscodedFootage, sw, err)
+        return err
+    }
+    updateState(ctx, updater, db.StateGenerateThumbnail, db.StateUploadTranscodedFootage, sw, nil)
+    sw.Stop()
+
+    return publishOutputs(ctx, updater, task, config, processor.Paths.BaseDir, "")
+}
+
+// repackageTask rebuilds the HLS output from the stored MP4 renditions, for
+// example to change the layout or encryption, without encoding again. The
+// source is not needed: what the packager knows about it is read from the
+// manifest stored with the renditions.
+func repackageTask(ctx context.Context, task Task, config *Config, updater *db.ProgressUpdater, workDir string) error {
+    sw := NewStopWatch("RestoreMP4Files")
+    mp4Dir := filepath.Join(workDir, "transcoded", "mp4")
+    if err := restoreOutputs(task, config, "mp4", mp4Dir); err != nil {
+        updateState(ctx, updater, db.StateDownload, db.StateInitializeProcessor, sw, err)
+        return err
+    }
+    updateState(ctx, updater, db.StateDownload, db.StateInitializeProcessor, sw, nil)
+    sw.Stop()
+
+    sw = NewStopWatch("Initialize Processor")
+    processorConfig, _, err := newProcessorConfig(task, config, updater)
+    if err != nil {
+        updateState(ctx, updater, db.StateInitializeProcessor, db.StateGenerateMP4Files, sw, err)
+        return err
+    }
+    // The renditions already exist, so there is nothing to publish live.
+    processorConfig.LowLatency = nil
+    processor, err := transcoder.OpenEncode(workDir, processorConfig)
+    if err != nil {
+        updateState(ctx, updater, db.StateInitializeProcessor, db.StateGenerateMP4Files, sw, err)
+        return err
+    }
+    updateState(ctx, updater, db.StateInitializeProcessor, db.StateGenerateMP4Files, sw, nil)
+    sw.Stop()
+
+    sw = NewStopWatch("LoadMP4Files")
+    s3client, err := s3.NewS3Client(config.AWSRegion, config.TransportBucket)
+    if err != nil {
+        updateState(ctx, updater, db.StateGenerateMP4Files, db.StateGenerateHLSPlaylists, sw, err)
+        return err
+    }
+    sidecarCaptions(ctx, updater, s3client, processor, task, workDir)
+    if err := processor.LoadMP4Files(); err != nil {
+        updateState(ctx, updater, db.StateGenerateMP4Files, db.StateGenerateHLSPlaylists, sw, err)
+        return err
+    }
+    updateState(ctx, updater, db.StateGenerateMP4Files, db.StateGenerateHLSPlaylists, sw, nil)
+    sw.Stop()
+
+    sw = NewStopWatch("GenerateHLSPlaylists")
+    if err := processor.GenerateHLSPlaylists(); err != nil {
+        updateState(ctx, updater, db.StateGenerateHLSPlaylists, db.StateGenerateIframePlaylists, sw, err)
+        return err
+    }
+    updateState(ctx, updater, db.StateGenerateHLSPlaylists, db.StateGenerateIframePlaylists, sw, nil)
+    sw.Stop()
+
+    sw = NewStopWatch("GenerateIframePlaylists")
+    if err := processor.GenerateIframePlaylists(); err != nil {
+        updateState(ctx, updater, db.StateGenerateIframePlaylists, db.StateUploadTranscodedFootage, sw, err)
+        return err
+    }
+    if err := processor.ValidateHLSOutput(); err != nil {
+        updateState(ctx, updater, db.StateGenerateIframePlaylists, db.StateUploadTranscodedFootage, sw, err)
+        return err
+    }
+    updateState(ctx, updater, db.StateGenerateIframePlaylists, db.StateUploadTranscodedFootage, sw, nil)
+    sw.Stop()
+
+    // The restored renditions are unchanged and stay where they are.
+    if err := os.RemoveAll(processor.Paths.MP4Dir); err != nil {
+        return err
+    }
+    return publishOutputs(ctx, updater, task, config, processor.Paths.BaseDir, "hls")
+}
+
+// audioExtractTask re-extracts and normalises the audio tracks. The HLS audio
+// playlists are rebuilt by a following REPACKAGE task.
+func audioExtractTask(ctx context.Context, task Task, config *Config, updater *db.ProgressUpdater, workDir string) error {
+    s3client, clips, err := downloadInputs(ctx, updater, task, config, workDir)
+    if err != nil {
+        return err
+    }
+    processor, _, err := initializeProcessor(ctx, updater, task, config, s3client, workDir, clips)
+    if err != nil {
+        return err
+    }
+
+    sw := NewStopWatch("ExtractAudio")
+    if err := processor.ExtractAudioTracks(); err != nil {
+        updateState(ctx, updater, db.StateGenerateMP4Files, db.StateUploadTranscodedFootage, sw, err)
+        return err
+    }
+    updateState(ctx, updater, db.StateGenerateMP4Files, db.StateUploadTranscodedFootage, sw, nil)
+    if err := updater.UpdateLoudness(ctx, loudnessRecords(processor.LoudnessReports)); err != nil {
+        log.Printf("Failed to update loudness report: %v", err)
+    }
+    sw.Stop()
+
+    return publishOutputs(ctx, updater, task, config, processor.Paths.BaseDir, "")
+}
+
+// deleteOutputsTask removes every object stored for the asset, including
+// the completion marker.
+func deleteOutputsTask(ctx context.Context, task Task, config *Config, updater *db.ProgressUpdater, workDir string) error {
+    sw := NewStopWatch("DeleteOutputs")
+    client, err := s3.NewS3Client(config.AWSRegion, config.ContentBucket)
+    if err != nil {
+        updateState(ctx, updater, db.StateUploadTranscodedFootage, db.StateUploadTranscodedFootage, sw, err)
+        return err
+    }
+
+    keys, err := client.ListKeys(path.Join(task.UserID, task.AssetID) + "/")
+    if err == nil {
+        err = client.DeleteKeys(keys)
+    }
+    updateState(ctx, updater, db.StateUploadTranscodedFootage, db.StateUploadTranscodedFootage, sw, err)
+    if err != nil {
+        return err
+    }
+    if err := updater.UpdateFileCount(ctx, 0); err != nil {
+        log.Printf("Failed to update file count: %v", err)
+    }
+    log.Printf("Deleted %d outputs", len(keys))
+    sw.Stop()
+    return nil
+}
+
+// restoreOutputs downloads the asset's stored outputs under dir into
+// localDir.
+func restoreOutputs(task Task, config *Config, dir, localDir string) error {
+    client, err := s3.NewS3Client(config.AWSRegion, config.ContentBucket)
+    if err != nil {
+        return err
+    }
+
+    prefix := path.Join(task.UserID, task.AssetID, dir) + "/"
+    keys, err := client.ListKeys(prefix)
+    if err != nil {
+        return err
+    }
+    if len(keys) == 0 {
+        return fmt.Errorf("no stored outputs under %s", prefix)
+    }
+
+    for _, key := range keys {
+        localPath := filepath.Join(localDir, filepath.FromSlash(strings.TrimPrefix(key, prefix)))
+        if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+            return err
+        }
+        if err := client.DownloadToFile(key, localPath); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// publishOutputs uploads a partial task's outputs next to the asset's
+// existing ones, then recounts the asset and rewrites the completion marker
+// so post-processing validation checks the whole asset again. Stored objects
+// under replaceDir that this run did not produce are deleted.
+func publishOutputs(ctx context.Context, updater *db.ProgressUpdater, task Task, config *Config, transcodedDir, replaceDir string) error {
+    sw := NewStopWatch("UploadAllParallel")
+    client, err := s3.NewS3Client(config.AWSRegion, config.ContentBucket)
+    if err != nil {
+        updateState(ctx, updater, db.StateUploadTranscodedFootage, db.StatePostProcessingValidation, sw, err)
+        return err
+    }
+
+    uploadManager := s3.NewUploadManager(client, task.UserID, task.AssetID, config.ContentBucket, &s3.UploadManagerConfig{
+        MaxWorkers: runtime.NumCPU(),
+        BufferSize: 1000,
+    })
+    if _, err := uploadManager.UploadAllParallel(transcodedDir); err != nil {
+        updateState(ctx, updater, db.StateUploadTranscodedFootage, db.StatePostProcessingValidation, sw, err)
+        return err
+    }
+
+    assetPrefix := path.Join(task.UserID, task.AssetID) + "/"
+    if replaceDir != "" {
+        if err := deleteStale(client, assetPrefix, transcodedDir, replaceDir); err != nil {
+            updateState(ctx, updater, db.StateUploadTranscodedFootage, db.StatePostProcessingValidation, sw, err)
+            return err
+        }
+    }
+
+    keys, err := client.ListKeys(assetPrefix)
+    if err != nil {
+        updateState(ctx, updater, db.StateUploadTranscodedFootage, db.StatePostProcessingValidation, sw, err)
+        return err
+    }
+    fileCount := 0
+    for _, key := range keys {
+        if strings.TrimPrefix(key, assetPrefix) != config.CompletionTrigger {
+            fileCount++
+        }
+    }
+    updateState(ctx, updater, db.StateUploadTranscodedFootage, db.StatePostProcessingValidation, sw, nil)
+    if err := updater.UpdateFileCount(ctx, fileCount); err != nil {
+        log.Printf("Failed to update file count: %v", err)
+    }
+    sw.Stop()
+
+    completionKey := path.Join(task.UserID, task.AssetID, config.CompletionTrigger)
+    return client.UploadFile(completionKey, createCompletionJSON(task.UserID, task.AssetID, fileCount), "application/json")
+}
+
+// deleteStale removes objects under dir that have no local counterpart, such
+// as segments of a layout that has been replaced.
+func deleteStale(client *s3.S3Client, assetPrefix, localDir, dir string) error {
+    keys, err := client.ListKeys(assetPrefix + dir + "/")
+    if err != nil {
+        return err
+    }
+
+    var stale []string
+    for _, key := range keys {
+        if _, err := os.Stat(filepath.Join(localDir, strings.TrimPrefix(key, assetPrefix))); os.IsNotExist(err) {
+            stale = append(stale, key)
+        }
+    }
+    if len(stale) > 0 {
+        log.Printf("Deleting %d stale outputs under %s", len(stale), dir)
+    }
+    return client.DeleteKeys(stale)
+}
\ No newline at end of file
@@ -6,21 +6,73 @@ import (
     "log"
     "os"
     "time"
+    "path"
     "path/filepath"
     "runtime"
     "context"
+    "strconv"
+    "strings"
 
+    "github.com/pkalsi97/ShortRelay/backend/workers/processor/internal/encryption"
+    "github.com/pkalsi97/ShortRelay/backend/workers/processor/internal/fingerprint"
     "github.com/pkalsi97/ShortRelay/backend/workers/processor/internal/storage/s3"
     "github.com/pkalsi97/ShortRelay/backend/workers/processor/internal/storage/dynamodb"
     "github.com/pkalsi97/ShortRelay/backend/workers/processor/internal/transcoder"
 )
 
+type CaptionInput struct {
+    Key      string  `json:"key"`
+    Language string  `json:"language"`
+    Label    string  `json:"label,omitempty"`
+    Offset   float64 `json:"offset,omitempty"`
+}
+
+type WatermarkInput struct {
+    Key      string  `json:"key"`
+    Position string  `json:"position,omitempty"`
+    Margin   float64 `json:"margin,omitempty"`
+    Opacity  float64 `json:"opacity,omitempty"`
+    Scale    float64 `json:"scale,omitempty"`
+    Start    float64 `json:"start,omitempty"`
+    End      float64 `json:"end,omitempty"`
+}
+
+type TrimRange struct {
+    Start float64 `json:"start"`
+    End   float64 `json:"end,omitempty"`
+}
+
+type TransitionInput struct {
+    Type     string  `json:"type"`
+    Duration float64 `json:"duration,omitempty"`
+}
+
 type Task struct {
-    TaskID    string `json:"taskId"`
-    UserID    string `json:"userId"`
-    AssetID   string `json:"assetId"`
-    InputKey  string `json:"inputKey"`
-    OutputKey string `json:"outputKey"`
+    TaskID         string           `json:"taskId"`
+    UserID         string           `json:"userId"`
+    AssetID        string           `json:"assetId"`
+    InputKey       string           `json:"inputKey"`
+    OutputKey      string           `json:"outputKey"`
+    LoudnessTarget string           `json:"loudnessTarget,omitempty"`
+    Captions       []CaptionInput   `json:"captions,omitempty"`
+    Encryption     string           `json:"encryption,omitempty"`
+    DRM            string           `json:"drm,omitempty"`
+    Watermark      *WatermarkInput  `json:"watermark,omitempty"`
+    StartTime      float64          `json:"startTime,omitempty"`
+    EndTime        float64          `json:"endTime,omitempty"`
+    Ranges         []TrimRange      `json:"ranges,omitempty"`
+    InputKeys      []string         `json:"inputKeys,omitempty"`
+    Transition     *TransitionInput `json:"transition,omitempty"`
+    Crop           string           `json:"crop,omitempty"`
+    FrameRate      float64          `json:"frameRate,omitempty"`
+    Vertical       string           `json:"vertical,omitempty"`
+    AlignToScenes  bool             `json:"alignToScenes,omitempty"`
+    HLSLayout      string           `json:"hlsLayout,omitempty"`
+    LowLatency     bool             `json:"lowLatency,omitempty"`
+    Chunks         int              `json:"chunks,omitempty"`
+    Profile        string           `json:"profile,omitempty"`
+    Type           string           `json:"type,omitempty"`
+    Worker         string           `json:"worker,omitempty"`
 }
 
 type Config struct {
@@ -31,6 +83,40 @@ type Config struct {
     ContentBucket       string
     MetadataTable       string
     CompletionTrigger   string
+    AudioRules          transcoder.AudioRules
+    SurroundAudio       transcoder.SurroundConfig
+    KeyURLTemplate      string
+    KeyWrappingKey      []byte
+    KeyStoreDir         string
+    DRMKeyProvider      encryption.KeyProvider
+    CropDetect          string
+    FrameRate           float64
+    Deinterlacer        string
+    SceneDetection      bool
+    SceneThreshold      float64
+    QualityGate         *transcoder.QualityGateConfig
+    FingerprintIndex    fingerprint.Index
+    FingerprintReuse    bool
+    FingerprintDistance float64
+    HLSLayout           string
+    LowLatency          bool
+    PartDuration        float64
+    EncodeMode          string
+    SingleDecodeMinCPUs int
+    ThreadBudget        int
+    ChunkCount          int
+    ChunkMinDuration    float64
+    RateControl         string
+    CRF                 int
+    Profiles            *transcoder.ProfileSet
+}
+
+type metadataKeyStore struct {
+    updater *db.ProgressUpdater
+}
+
+func (s *metadataKeyStore) StoreKey(ctx context.Context, assetID string, key encryption.WrappedKey) error {
+    return s.updater.UpdateEncryptionKey(ctx, db.KeyRecord(key))
 }
 
 type StopWatch struct {
@@ -94,6 +180,307 @@ func createCompletionJSON(userId, assetId string, fileCount int) []byte {
     return []byte(completionJSON)
 }
 
+func encryptionConfig(task Task, config *Config, updater *db.ProgressUpdater) (*transcoder.EncryptionConfig, error) {
+    switch task.Encryption {
+    case "":
+        return nil, nil
+    case transcoder.EncryptionAES128, transcoder.EncryptionSampleAES:
+    default:
+        return nil, fmt.Errorf("unsupported encryption method: %s", task.Encryption)
+    }
+    if config.KeyURLTemplate == "" || config.KeyWrappingKey == nil {
+        return nil, fmt.Errorf("encryption requires KEY_URL_TEMPLATE and KEY_WRAPPING_KEY")
+    }
+
+    var keyStore encryption.KeyStore = &metadataKeyStore{updater: updater}
+    if config.KeyStoreDir != "" {
+        fileStore, err := encryption.NewFileKeyStore(config.KeyStoreDir)
+        if err != nil {
+            return nil, err
+        }
+        keyStore = fileStore
+    }
+
+    return &transcoder.EncryptionConfig{
+        Method:         task.Encryption,
+        KeyURLTemplate: config.KeyURLTemplate,
+        WrappingKey:    config.KeyWrappingKey,
+        KeyStore:       keyStore,
+        UserID:         task.UserID,
+        AssetID:        task.AssetID,
+    }, nil
+}
+
+func drmConfig(task Task, config *Config) (*transcoder.DRMConfig, error) {
+    switch task.DRM {
+    case "":
+        return nil, nil
+    case encryption.SchemeCENC, encryption.SchemeCBCS:
+    default:
+        return nil, fmt.Errorf("unsupported DRM scheme: %s", task.DRM)
+    }
+    if task.Encryption != "" {
+        return nil, fmt.Errorf("encryption and drm cannot be combined")
+    }
+    if config.DRMKeyProvider == nil {
+        return nil, fmt.Errorf("DRM packaging requires a key provider")
+    }
+
+    return &transcoder.DRMConfig{
+        Scheme:   task.DRM,
+        Provider: config.DRMKeyProvider,
+        AssetID:  task.AssetID,
+    }, nil
+}
+
+func transition(input *TransitionInput) *transcoder.Transition {
+    if input == nil {
+        return nil
+    }
+    return &transcoder.Transition{Type: input.Type, Duration: input.Duration}
+}
+
+// checkQuality records the report on every run and only fails the task when
+// the gate rejects the asset; flagged assets continue to publish.
+func checkQuality(ctx context.Context, updater *db.ProgressUpdater, processor *transcoder.Processor) error {
+    report, err := processor.CheckQuality()
+    if err != nil {
+        return err
+    }
+
+    if err := updater.UpdateQuality(ctx, db.QualityRecord(*report)); err != nil {
+        log.Printf("Failed to update quality report: %v", err)
+    }
+
+    if report.Verdict == transcoder.QualityRejected {
+        return fmt.Errorf("rejected by quality gate: %s", strings.Join(report.Reasons, "; "))
+    }
+    if report.Verdict == transcoder.QualityFlagged {
+        log.Printf("Asset flagged by quality gate: %s", strings.Join(report.Reasons, "; "))
+    }
+    return nil
+}
+
+// taskVariant keys the fingerprint index with the task's output options, so
+// two uploads only share outputs when they asked for the same ones. The user
+// stays in the key, so an asset only ever matches outputs of the same user.
+// Object keys are per-asset and chunking and low latency leave the outputs
+// unchanged, so they are left out or a re-upload would never match.
+func taskVariant(task Task) string {
+    task.TaskID, task.AssetID = "", ""
+    task.InputKey, task.InputKeys, task.OutputKey = "", nil, ""
+    task.Chunks, task.LowLatency = 0, false
+    captions := make([]CaptionInput, len(task.Captions))
+    for i, caption := range task.Captions {
+        caption.Key = ""
+        captions[i] = caption
+    }
+    task.Captions = captions
+    if task.Watermark != nil {
+        watermark := *task.Watermark
+        watermark.Key = ""
+        task.Watermark = &watermark
+    }
+    variant, _ := json.Marshal(task)
+    return string(variant)
+}
+
+func fingerprintAsset(ctx context.Context, updater *db.ProgressUpdater, processor *transcoder.Processor, config *Config, variant string) (*fingerprint.Signature, string, error) {
+    signature, err := processor.Fingerprint()
+    if err != nil {
+        return nil, "", err
+    }
+
+    matches, err := config.FingerprintIndex.Find(ctx, signature, variant, config.FingerprintDistance)
+    if err != nil {
+        return signature, "", err
+    }
+
+    record := db.FingerprintRecord{
+        Duration: signature.Duration,
+        DHashes:  signature.DHashes(),
+        PHashes:  signature.PHashes(),
+        Audio:    signature.AudioHex(),
+    }
+    if len(matches) > 0 {
+        record.DuplicateOf = matches[0].ID
+        record.Distance = matches[0].Distance
+        log.Printf("Asset matches %s (distance %.4f)", matches[0].ID, matches[0].Distance)
+    }
+    if err := updater.UpdateFingerprint(ctx, record); err != nil {
+        log.Printf("Failed to update fingerprint: %v", err)
+    }
+
+    return signature, record.DuplicateOf, nil
+}
+
+// reusable reports whether an asset's outputs may be copied to or from
+// another asset. Protected outputs reference their own asset's keys, so they
+// never are.
+func reusable(task Task) bool {
+    return task.Encryption == "" && task.DRM == ""
+}
+
+// reuseOutputs publishes a duplicate by copying the matched asset's outputs
+// under this asset's prefix, then completes the task as a normal upload would.
+func reuseOutputs(ctx context.Context, updater *db.ProgressUpdater, task Task, config *Config, sourcePrefix string) error {
+    sw := NewStopWatch("ReuseOutputs")
+    if !reusable(task) || !strings.HasPrefix(sourcePrefix, task.UserID+"/") {
+        err := fmt.Errorf("outputs of %s cannot be reused for %s/%s", sourcePrefix, task.UserID, task.AssetID)
+        updateState(ctx, updater, db.StateUploadTranscodedFootage, db.StatePostProcessingValidation, sw, err)
+        return err
+    }
+    client, err := s3.NewS3Client(config.AWSRegion, config.ContentBucket)
+    if err != nil {
+        updateState(ctx, updater, db.StateUploadTranscodedFootage, db.StatePostProcessingValidation, sw, err)
+        return err
+    }
+
+    keys, err := client.ListKeys(sourcePrefix + "/")
+    if err != nil {
+        updateState(ctx, updater, db.StateUploadTranscodedFootage, db.StatePostProcessingValidation, sw, err)
+        return err
+    }
+
+    fileCount := 0
+    for _, key := range keys {
+        relative := strings.TrimPrefix(key, sourcePrefix+"/")
+        if relative == config.CompletionTrigger {
+            continue
+        }
+        if err := client.CopyFile(key, path.Join(task.UserID, task.AssetID, relative)); err != nil {
+            updateState(ctx, updater, db.StateUploadTranscodedFootage, db.StatePostProcessingValidation, sw, err)
+            return err
+        }
+        fileCount++
+    }
+    updateState(ctx, updater, db.StateUploadTranscodedFootage, db.StatePostProcessingValidation, sw, nil)
+    if err := updater.UpdateFileCount(ctx, fileCount); err != nil {
+        log.Printf("Failed to update file count: %v", err)
+    }
+    sw.Stop()
+
+    completionKey := path.Join(task.UserID, task.AssetID, config.CompletionTrigger)
+    return client.UploadFile(completionKey, createCompletionJSON(task.UserID, task.AssetID, fileCount), "application/json")
+}
+
+func trimRanges(task Task) ([]transcoder.TimeRange, error) {
+    if len(task.Ranges) > 0 {
+        if task.StartTime != 0 || task.EndTime != 0 {
+            return nil, fmt.Errorf("startTime/endTime cannot be combined with ranges")
+        }
+        ranges := make([]transcoder.TimeRange, 0, len(task.Ranges))
+        for _, r := range task.Ranges {
+            ranges = append(ranges, transcoder.TimeRange{Start: r.Start, End: r.End})
+        }
+        return ranges, nil
+    }
+
+    if task.StartTime == 0 && task.EndTime == 0 {
+        return nil, nil
+    }
+    return []transcoder.TimeRange{{Start: task.StartTime, End: task.EndTime}}, nil
+}
+
+func downloadWatermark(client *s3.S3Client, input *WatermarkInput, workDir string) (*transcoder.Watermark, error) {
+    if input == nil {
+        return nil, nil
+    }
+
+    data, err := client.DownloadFile(input.Key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to download watermark: %v", err)
+    }
+
+    imagePath := filepath.Join(workDir, "watermark"+filepath.Ext(input.Key))
+    if err := os.WriteFile(imagePath, data, 0644); err != nil {
+        return nil, fmt.Errorf("failed to write watermark: %v", err)
+    }
+
+    watermark := &transcoder.Watermark{
+        ImagePath: imagePath,
+        Position:  input.Position,
+        Margin:    input.Margin,
+        Opacity:   input.Opacity,
+        Scale:     input.Scale,
+        Start:     input.Start,
+        End:       input.End,
+    }
+    if err := watermark.Validate(); err != nil {
+        return nil, err
+    }
+    return watermark, nil
+}
+
+// Caption problems are reported per file and never fail the task.
+func addSidecarCaptions(client *s3.S3Client, processor *transcoder.Processor, captions []CaptionInput, workDir string) map[string]string {
+    captionErrors := make(map[string]string)
+    captionDir := filepath.Join(workDir, "captions")
+    if err := os.MkdirAll(captionDir, 0755); err != nil {
+        for _, caption := range captions {
+            captionErrors[caption.Key] = err.Error()
+        }
+        return captionErrors
+    }
+
+    for i, caption := range captions {
+        data, err := client.DownloadFile(caption.Key)
+        if err != nil {
+            captionErrors[caption.Key] = err.Error()
+            continue
+        }
+
+        localPath := filepath.Join(captionDir, fmt.Sprintf("%d%s", i, filepath.Ext(caption.Key)))
+        if err := os.WriteFile(localPath, data, 0644); err != nil {
+            captionErrors[caption.Key] = err.Error()
+            continue
+        }
+
+        err = processor.AddSidecarSubtitle(transcoder.SidecarSubtitle{
+            Path:     localPath,
+            Language: caption.Language,
+            Label:    caption.Label,
+            Offset:   caption.Offset,
+        })
+        if err != nil {
+            log.Printf("Caption %s rejected: %v", caption.Key, err)
+            captionErrors[caption.Key] = err.Error()
+        }
+    }
+
+    return captionErrors
+}
+
+// sidecarCaptions attaches the task's caption files, recording the ones that
+// could not be used rather than failing the task.
+func sidecarCaptions(ctx context.Context, updater *db.ProgressUpdater, client *s3.S3Client, processor *transcoder.Processor, task Task, workDir string) {
+    if len(task.Captions) == 0 {
+        return
+    }
+    sw := NewStopWatch("SidecarCaptions")
+    captionErrors := addSidecarCaptions(client, processor, task.Captions, workDir)
+    if len(captionErrors) > 0 {
+        if err := updater.UpdateCaptionErrors(ctx, captionErrors); err != nil {
+            log.Printf("Failed to update caption errors: %v", err)
+        }
+    }
+    sw.Stop()
+}
+
+func loudnessRecords(reports []transcoder.LoudnessReport) []db.LoudnessRecord {
+    records := make([]db.LoudnessRecord, 0, len(reports))
+    for _, report := range reports {
+        records = append(records, db.LoudnessRecord{
+            Track:             report.Track,
+            Target:            db.LoudnessTarget(report.Target),
+            Input:             db.LoudnessValues(report.Input),
+            Output:            db.LoudnessValues(report.Output),
+            NormalizationType: report.NormalizationType,
+        })
+    }
+    return records
+}
+
 func loadConfig() (*Config, error) {
     config := &Config{}
     
@@ -126,34 +513,257 @@ func loadConfig() (*Config, error) {
         return nil, fmt.Errorf("missing required environment variables: %v", missingVars)
     }
 
-    return config, nil
-}
+    config.AudioRules = transcoder.AudioRules{
+        DefaultLanguages:    splitList(os.Getenv("AUDIO_DEFAULT_LANGUAGES")),
+        AutoSelectLanguages: splitList(os.Getenv("AUDIO_AUTOSELECT_LANGUAGES")),
+    }
+
+    surroundCodec := os.Getenv("AUDIO_SURROUND_CODEC")
+    switch surroundCodec {
+    case "", "aac", "eac3":
+    case "none":
+        config.SurroundAudio.Disabled = true
+    default:
+        return nil, fmt.Errorf("unsupported AUDIO_SURROUND_CODEC: %s", surroundCodec)
+    }
+    if !config.SurroundAudio.Disabled {
+        config.SurroundAudio.Codec = surroundCodec
+        config.SurroundAudio.Bitrate = os.Getenv("AUDIO_SURROUND_BITRATE")
+    }
+
+    config.CropDetect = os.Getenv("CROP_DETECT")
+    switch config.CropDetect {
+    case "", transcoder.CropAuto, transcoder.CropOff:
+    default:
+        return nil, fmt.Errorf("unsupported CROP_DETECT: %s", config.CropDetect)
+    }
+
+    if frameRate := os.Getenv("TARGET_FRAME_RATE"); frameRate != "" {
+        rate, err := strconv.ParseFloat(frameRate, 64)
+        if err != nil || rate <= 0 {
+            return nil, fmt.Errorf("invalid TARGET_FRAME_RATE: %s", frameRate)
+        }
+        config.FrameRate = rate
+    }
+    config.Deinterlacer = os.Getenv("DEINTERLACER")
+    switch config.Deinterlacer {
+    case "", transcoder.DeinterlaceBwdif, transcoder.DeinterlaceYadif:
+    default:
+        return nil, fmt.Errorf("unsupported DEINTERLACER: %s", config.Deinterlacer)
+    }
+
+    // Scene detection decodes the whole source once more, so it is opt-in.
+    switch os.Getenv("SCENE_DETECTION") {
+    case "on":
+        config.SceneDetection = true
+    case "", "off":
+    default:
+        return nil, fmt.Errorf("unsupported SCENE_DETECTION: %s", os.Getenv("SCENE_DETECTION"))
+    }
+    if threshold := os.Getenv("SCENE_THRESHOLD"); threshold != "" {
+        value, err := strconv.ParseFloat(threshold, 64)
+        if err != nil || value <= 0 || value >= 1 {
+            return nil, fmt.Errorf("invalid SCENE_THRESHOLD: %s", threshold)
+        }
+        config.SceneThreshold = value
+    }
+
+    if os.Getenv("QUALITY_GATE") != "off" {
+        gate := transcoder.DefaultQualityGate()
+        thresholds := map[string]*float64{
+            "QUALITY_BLACK_FLAG":     &gate.Black.Flag,
+            "QUALITY_BLACK_REJECT":   &gate.Black.Reject,
+            "QUALITY_FREEZE_FLAG":    &gate.Freeze.Flag,
+            "QUALITY_FREEZE_REJECT":  &gate.Freeze.Reject,
+            "QUALITY_SILENCE_FLAG":   &gate.Silence.Flag,
+            "QUALITY_SILENCE_REJECT": &gate.Silence.Reject,
+        }
+        for name, threshold := range thresholds {
+            value := os.Getenv(name)
+            if value == "" {
+                continue
+            }
+            percent, err := strconv.ParseFloat(value, 64)
+            if err != nil || percent < 0 || percent > 100 {
+                return nil, fmt.Errorf("invalid %s: %s", name, value)
+            }
+            *threshold = percent
+        }
+        config.QualityGate = &gate
+    }
+
+    // The index only lives as long as the process, so fingerprinting is
+    // opt-in until a persistent index exists.
+    if os.Getenv("FINGERPRINT") == "on" {
+        config.FingerprintIndex = fingerprint.NewMemoryIndex()
+        config.FingerprintReuse = os.Getenv("FINGERPRINT_REUSE") == "on"
+        config.FingerprintDistance = 0.1
+        if distance := os.Getenv("FINGERPRINT_MAX_DISTANCE"); distance != "" {
+            value, err := strconv.ParseFloat(distance, 64)
+            if err != nil || value < 0 || value > 1 {
+                return nil, fmt.Errorf("invalid FINGERPRINT_MAX_DISTANCE: %s", distance)
+            }
+            config.FingerprintDistance = value
+        }
+    }
+
+    encodeMode, err := transcoder.ParseEncodeMode(os.Getenv("ENCODE_MODE"))
+    if err != nil {
+        return nil, err
+    }
+    config.EncodeMode = encodeMode
+    if cpus := os.Getenv("SINGLE_DECODE_MIN_CPUS"); cpus != "" {
+        value, err := strconv.Atoi(cpus)
+        if err != nil || value < 1 {
+            return nil, fmt.Errorf("invalid SINGLE_DECODE_MIN_CPUS: %s", cpus)
+        }
+        config.SingleDecodeMinCPUs = value
+    }
+    if budget := os.Getenv("THREAD_BUDGET"); budget != "" {
+        value, err := strconv.Atoi(budget)
+        if err != nil || value < 1 {
+            return nil, fmt.Errorf("invalid THREAD_BUDGET: %s", budget)
+        }
+        config.ThreadBudget = value
+    }
+    config.RateControl = os.Getenv("RATE_CONTROL")
+    if crf := os.Getenv("RATE_CONTROL_CRF"); crf != "" {
+        value, err := strconv.Atoi(crf)
+        if err != nil {
+            return nil, fmt.Errorf("invalid RATE_CONTROL_CRF: %s", crf)
+        }
+        config.CRF = value
+    }
+    if chunks := os.Getenv("CHUNK_COUNT"); chunks != "" {
+        value, err := strconv.Atoi(chunks)
+        if err != nil || value < 0 {
+            return nil, fmt.Errorf("invalid CHUNK_COUNT: %s", chunks)
+        }
+        config.ChunkCount = value
+    }
+    if minDuration := os.Getenv("CHUNK_MIN_DURATION"); minDuration != "" {
+        value, err := strconv.ParseFloat(minDuration, 64)
+        if err != nil || value < 0 {
+            return nil, fmt.Errorf("invalid CHUNK_MIN_DURATION: %s", minDuration)
+        }
+        config.ChunkMinDuration = value
+    }
 
+    config.HLSLayout = os.Getenv("HLS_LAYOUT")
+    config.LowLatency = os.Getenv("LL_HLS") == "on"
+    if partDuration := os.Getenv("LL_HLS_PART_DURATION"); partDuration != "" {
+        value, err := strconv.ParseFloat(partDuration, 64)
+        if err != nil || value <= 0 {
+            return nil, fmt.Errorf("invalid LL_HLS_PART_DURATION: %s", partDuration)
+        }
+        config.PartDuration = value
+    }
 
-func processTask(ctx context.Context, task Task, config *Config) error {
-    workDir := filepath.Join(config.FootageDir, task.UserID, task.AssetID)
-    defer os.RemoveAll(workDir)
+    config.KeyURLTemplate = os.Getenv("KEY_URL_TEMPLATE")
+    config.KeyStoreDir = os.Getenv("KEY_STORE_DIR")
+    if wrappingKey := os.Getenv("KEY_WRAPPING_KEY"); wrappingKey != "" {
+        key, err := encryption.ParseHexKey(wrappingKey)
+        if err != nil {
+            return nil, fmt.Errorf("invalid KEY_WRAPPING_KEY: %v", err)
+        }
+        config.KeyWrappingKey = key
+    }
 
-    swm := NewStopWatch(fmt.Sprintf("Overall-Task-%s", task.TaskID))
-    defer swm.Stop()
+    if drmKeyID := os.Getenv("DRM_KEY_ID"); drmKeyID != "" {
+        provider, err := encryption.NewStaticKeyProvider(drmKeyID, os.Getenv("DRM_KEY"), os.Getenv("DRM_HLS_KEY_URI"))
+        if err != nil {
+            return nil, fmt.Errorf("invalid static DRM key: %v", err)
+        }
+        config.DRMKeyProvider = provider
+    }
 
-    // Initialize progress updater
-    updater, err := db.NewProgressUpdater(config.AWSRegion, config.MetadataTable, task.UserID, task.AssetID)
+    config.Profiles, err = loadProfiles(config)
     if err != nil {
-        return fmt.Errorf("failed to create progress updater: %v", err)
+        return nil, err
+    }
+
+    return config, nil
+}
+
+// loadProfiles reads the encoding profiles from exactly one of PROFILES
+// (inline YAML or JSON), PROFILES_FILE or PROFILES_S3_KEY. With none set only
+// the built-in default profile is available.
+func loadProfiles(config *Config) (*transcoder.ProfileSet, error) {
+    inline := os.Getenv("PROFILES")
+    file := os.Getenv("PROFILES_FILE")
+    key := os.Getenv("PROFILES_S3_KEY")
+
+    sources := 0
+    for _, value := range []string{inline, file, key} {
+        if value != "" {
+            sources++
+        }
+    }
+    if sources == 0 {
+        return nil, nil
     }
+    if sources > 1 {
+        return nil, fmt.Errorf("set only one of PROFILES, PROFILES_FILE and PROFILES_S3_KEY")
+    }
+
+    var data []byte
+    switch {
+    case inline != "":
+        data = []byte(inline)
+    case file != "":
+        var err error
+        if data, err = os.ReadFile(file); err != nil {
+            return nil, fmt.Errorf("failed to read profiles file: %v", err)
+        }
+    default:
+        bucket := os.Getenv("PROFILES_S3_BUCKET")
+        if bucket == "" {
+            bucket = config.TransportBucket
+        }
+        client, err := s3.NewS3Client(config.AWSRegion, bucket)
+        if err != nil {
+            return nil, err
+        }
+        if data, err = client.DownloadFile(key); err != nil {
+            return nil, fmt.Errorf("failed to download profiles: %v", err)
+        }
+    }
+    return transcoder.ParseProfiles(data)
+}
 
+func splitList(value string) []string {
+    var items []string
+    for _, item := range strings.Split(value, ",") {
+        if item = strings.TrimSpace(item); item != "" {
+            items = append(items, item)
+        }
+    }
+    return items
+}
+
+
+// downloadInputs fetches the task's sources from the transport bucket and
+// writes them into workDir, returning the local clip paths.
+func downloadInputs(ctx context.Context, updater *db.ProgressUpdater, task Task, config *Config, workDir string) (*s3.S3Client, []string, error) {
     // Download
     sw := NewStopWatch("Download")
     s3client, err := s3.NewS3Client(config.AWSRegion, config.TransportBucket)
     if err != nil {
         updateState(ctx, updater, db.StateDownload, db.StateWriteToStorage, sw, err)
-        return err
+        return nil, nil, err
     }
-    downloadedData, err := s3client.DownloadFile(task.InputKey)
-    if err != nil {
-        updateState(ctx, updater, db.StateDownload, db.StateWriteToStorage, sw, err)
-        return err
+    inputKeys := task.InputKeys
+    if len(inputKeys) == 0 {
+        inputKeys = []string{task.InputKey}
+    }
+    downloads := make([][]byte, 0, len(inputKeys))
+    for _, key := range inputKeys {
+        downloadedData, err := s3client.DownloadFile(key)
+        if err != nil {
+            updateState(ctx, updater, db.StateDownload, db.StateWriteToStorage, sw, err)
+            return nil, nil, err
+        }
+        downloads = append(downloads, downloadedData)
     }
     updateState(ctx, updater, db.StateDownload, db.StateWriteToStorage, sw, nil)
     sw.Stop()
@@ -162,34 +772,203 @@ func processTask(ctx context.Context, task Task, config *Config) error {
     sw = NewStopWatch("Write Temp")
     if err := os.MkdirAll(workDir, 0755); err != nil {
         updateState(ctx, updater, db.StateWriteToStorage, db.StateInitializeProcessor, sw, err)
-        return err
+        return nil, nil, err
     }
     tempFile := filepath.Join(workDir, "input")
-    if err := os.WriteFile(tempFile, downloadedData, 0644); err != nil {
-        updateState(ctx, updater, db.StateWriteToStorage, db.StateInitializeProcessor, sw, err)
-        return err
+    clips := make([]string, 0, len(downloads))
+    for i, data := range downloads {
+        clip := tempFile
+        if len(downloads) > 1 {
+            clip = filepath.Join(workDir, fmt.Sprintf("input_%03d", i))
+        }
+        if err := os.WriteFile(clip, data, 0644); err != nil {
+            updateState(ctx, updater, db.StateWriteToStorage, db.StateInitializeProcessor, sw, err)
+            return nil, nil, err
+        }
+        clips = append(clips, clip)
     }
+    downloads = nil
     updateState(ctx, updater, db.StateWriteToStorage, db.StateInitializeProcessor, sw, nil)
     sw.Stop()
 
-    // Define resolutions
-    resolutions := []transcoder.Resolution{
-        {Name: "1080p", Width: 1920, Height: 1080, Bitrate: "3000k"},
-        {Name: "720p", Width: 1280, Height: 720, Bitrate: "2000k"},
-        {Name: "480p", Width: 854, Height: 480, Bitrate: "800k"},
-        {Name: "360p", Width: 640, Height: 360, Bitrate: "400k"},
+    return s3client, clips, nil
+}
+
+// newProcessorConfig builds the task's processor configuration and the
+// renditions of its profile.
+func newProcessorConfig(task Task, config *Config, updater *db.ProgressUpdater) (*transcoder.ProcessorConfig, []transcoder.Resolution, error) {
+    profile, err := config.Profiles.Profile(task.Profile)
+    if err != nil {
+        return nil, nil, err
+    }
+    log.Printf("Using encoding profile %s", profile.Name)
+
+    // RATE_CONTROL only fills in renditions the profile leaves unset.
+    resolutions := profile.Renditions
+    for i := range resolutions {
+        if resolutions[i].RateControl == "" {
+            resolutions[i].RateControl = config.RateControl
+            resolutions[i].CRF = config.CRF
+        }
     }
 
+    processorConfig := &transcoder.ProcessorConfig{
+        AudioRules:    config.AudioRules,
+        SurroundAudio: config.SurroundAudio,
+        Profile:       profile,
+    }
+    processorConfig.Loudness, err = transcoder.LoudnessTargetFor(task.LoudnessTarget)
+    if err != nil {
+        return nil, nil, err
+    }
+    processorConfig.Encryption, err = encryptionConfig(task, config, updater)
+    if err != nil {
+        return nil, nil, err
+    }
+    processorConfig.DRM, err = drmConfig(task, config)
+    if err != nil {
+        return nil, nil, err
+    }
+    if config.SceneDetection {
+        processorConfig.Scenes = &transcoder.SceneConfig{
+            Threshold:     config.SceneThreshold,
+            AlignSegments: task.AlignToScenes,
+        }
+    }
+    processorConfig.QualityGate = config.QualityGate
+    processorConfig.EncodeMode = config.EncodeMode
+    processorConfig.SingleDecodeMinCPUs = config.SingleDecodeMinCPUs
+    processorConfig.ThreadBudget = config.ThreadBudget
+    chunks := task.Chunks
+    if chunks == 0 {
+        chunks = config.ChunkCount
+    }
+    if chunks > 1 {
+        processorConfig.Chunking = &transcoder.ChunkConfig{Count: chunks, MinDuration: config.ChunkMinDuration}
+    }
+    processorConfig.Vertical = task.Vertical
+    processorConfig.Deinterlacer = config.Deinterlacer
+    processorConfig.FrameRate = task.FrameRate
+    if processorConfig.FrameRate == 0 {
+        processorConfig.FrameRate = config.FrameRate
+    }
+    processorConfig.Crop = task.Crop
+    if processorConfig.Crop == "" {
+        processorConfig.Crop = config.CropDetect
+    }
+    hlsLayout := task.HLSLayout
+    if hlsLayout == "" {
+        hlsLayout = profile.Packaging.Layout
+    }
+    if hlsLayout == "" {
+        hlsLayout = config.HLSLayout
+    }
+    processorConfig.HLSLayout, err = transcoder.ParseHLSLayout(hlsLayout)
+    if err != nil {
+        return nil, nil, err
+    }
+    if task.LowLatency || config.LowLatency {
+        processorConfig.LowLatency = &transcoder.LowLatencyConfig{PartDuration: config.PartDuration}
+    }
+    processorConfig.Trim, err = trimRanges(task)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    return processorConfig, resolutions, nil
+}
+
+// initializeProcessor builds the task's processor configuration and probes
+// the source. Multiple clips are first joined into one input.
+func initializeProcessor(ctx context.Context, updater *db.ProgressUpdater, task Task, config *Config, s3client *s3.S3Client, workDir string, clips []string) (*transcoder.Processor, *transcoder.ProcessorConfig, error) {
     // Initialize Processor
-    sw = NewStopWatch("Initialize Processor")
-    processor, err := transcoder.NewProcessor(tempFile, resolutions)
+    sw := NewStopWatch("Initialize Processor")
+    processorConfig, resolutions, err := newProcessorConfig(task, config, updater)
+    if err != nil {
+        updateState(ctx, updater, db.StateInitializeProcessor, db.StateQualityGate, sw, err)
+        return nil, nil, err
+    }
+    processorConfig.Watermark, err = downloadWatermark(s3client, task.Watermark, workDir)
+    if err != nil {
+        updateState(ctx, updater, db.StateInitializeProcessor, db.StateQualityGate, sw, err)
+        return nil, nil, err
+    }
+
+    tempFile := clips[0]
+    if len(clips) > 1 {
+        tempFile = filepath.Join(workDir, "concat.mkv")
+        if err := transcoder.Concatenate(clips, tempFile, transition(task.Transition)); err != nil {
+            updateState(ctx, updater, db.StateInitializeProcessor, db.StateQualityGate, sw, err)
+            return nil, nil, err
+        }
+    }
+
+    processor, err := transcoder.NewProcessor(tempFile, resolutions, processorConfig)
+    if err != nil {
+        updateState(ctx, updater, db.StateInitializeProcessor, db.StateQualityGate, sw, err)
+        return nil, nil, err
+    }
+    if crop := processor.Crop; crop != nil {
+        record := db.CropRecord{Width: crop.Width, Height: crop.Height, X: crop.X, Y: crop.Y, Source: processor.CropSource}
+        if err := updater.UpdateCrop(ctx, record); err != nil {
+            log.Printf("Failed to update crop: %v", err)
+        }
+    }
+    if err := updater.UpdateFrameCadence(ctx, db.CadenceRecord(processor.Cadence)); err != nil {
+        log.Printf("Failed to update frame cadence: %v", err)
+    }
+    updateState(ctx, updater, db.StateInitializeProcessor, db.StateQualityGate, sw, nil)
+    sw.Stop()
+
+    return processor, processorConfig, nil
+}
+
+// transcodeTask runs the full pipeline, from the source download to the
+// completion marker.
+func transcodeTask(ctx context.Context, task Task, config *Config, updater *db.ProgressUpdater, workDir string) error {
+    s3client, clips, err := downloadInputs(ctx, updater, task, config, workDir)
     if err != nil {
-        updateState(ctx, updater, db.StateInitializeProcessor, db.StateGenerateThumbnail, sw, err)
         return err
     }
-    updateState(ctx, updater, db.StateInitializeProcessor, db.StateGenerateThumbnail, sw, nil)
+    processor, processorConfig, err := initializeProcessor(ctx, updater, task, config, s3client, workDir, clips)
+    if err != nil {
+        return err
+    }
+
+    // Quality gate
+    sw := NewStopWatch("QualityGate")
+    if config.QualityGate != nil {
+        if err := checkQuality(ctx, updater, processor); err != nil {
+            updateState(ctx, updater, db.StateQualityGate, db.StateFingerprint, sw, err)
+            return err
+        }
+    }
+    updateState(ctx, updater, db.StateQualityGate, db.StateFingerprint, sw, nil)
     sw.Stop()
 
+    // Fingerprint
+    sw = NewStopWatch("Fingerprint")
+    var signature *fingerprint.Signature
+    variant := taskVariant(task)
+    if config.FingerprintIndex != nil {
+        var duplicateOf string
+        signature, duplicateOf, err = fingerprintAsset(ctx, updater, processor, config, variant)
+        if err != nil {
+            // Fingerprinting only saves work, so a failure must not block publishing.
+            log.Printf("Fingerprinting failed: %v", err)
+        }
+        if duplicateOf != "" && config.FingerprintReuse && reusable(task) {
+            updateState(ctx, updater, db.StateFingerprint, db.StateUploadTranscodedFootage, sw, nil)
+            sw.Stop()
+            return reuseOutputs(ctx, updater, task, config, duplicateOf)
+        }
+    }
+    updateState(ctx, updater, db.StateFingerprint, db.StateGenerateThumbnail, sw, nil)
+    sw.Stop()
+
+    // Sidecar captions
+    sidecarCaptions(ctx, updater, s3client, processor, task, workDir)
+
     // Create Thumbnail
     sw = NewStopWatch("GenerateThumbnail")
     err = processor.GenerateThumbnail();
@@ -204,6 +983,33 @@ func processTask(ctx context.Context, task Task, config *Config) error {
 
     // GenerateMP4Files
     sw = NewStopWatch("GenerateMP4Files")
+    s3ContentClient, err := s3.NewS3Client(config.AWSRegion, config.ContentBucket)
+    if err != nil {
+        log.Printf("S3 content client creation failed: %v", err)
+        updateState(ctx, updater, db.StateGenerateMP4Files, db.StateGenerateHLSPlaylists, sw, err)
+        os.Exit(1)
+    }
+
+    uploadConfig := &s3.UploadManagerConfig{
+        MaxWorkers: runtime.NumCPU(),
+        BufferSize: 1000,
+    }
+
+    uploadManager := s3.NewUploadManager(
+        s3ContentClient,
+        task.UserID,
+        task.AssetID,
+        config.ContentBucket,
+        uploadConfig,
+    )
+
+    // Low-latency renditions are published while they encode.
+    transcodedDir := filepath.Join(workDir, "transcoded")
+    if processorConfig.LowLatency != nil {
+        processorConfig.LowLatency.Publisher = uploadManager.Publisher(transcodedDir)
+    }
+
+    log.Printf("Encoding %d renditions in %s mode", len(processor.Resolutions), processor.EncodeMode())
     err = processor.GenerateMP4Files(); 
     if err != nil {
         log.Printf("GenerateMP4Files failed: %v", err)
@@ -211,6 +1017,9 @@ func processTask(ctx context.Context, task Task, config *Config) error {
         os.Exit(1)
     }
     updateState(ctx, updater, db.StateGenerateMP4Files, db.StateGenerateHLSPlaylists,sw ,err)
+    if err := updater.UpdateLoudness(ctx, loudnessRecords(processor.LoudnessReports)); err != nil {
+        log.Printf("Failed to update loudness report: %v", err)
+    }
     sw.Stop()
 
 
@@ -232,32 +1041,17 @@ func processTask(ctx context.Context, task Task, config *Config) error {
         log.Printf("GenerateIframePlaylists failed: %v", err)
         os.Exit(1)
     }
+    err = processor.ValidateHLSOutput()
+    if err != nil {
+        log.Printf("HLS validation failed: %v", err)
+        updateState(ctx, updater, db.StateGenerateIframePlaylists, db.StateUploadTranscodedFootage,sw ,err)
+        os.Exit(1)
+    }
     updateState(ctx, updater, db.StateGenerateIframePlaylists, db.StateUploadTranscodedFootage,sw ,err)
     sw.Stop()
 
     // Upload
     sw = NewStopWatch("UploadAllParallel")
-    s3ContentClient, err := s3.NewS3Client(config.AWSRegion, config.ContentBucket)
-    if err != nil {
-        log.Printf("S3 content client creation failed: %v", err)
-        updateState(ctx, updater, db.StateUploadTranscodedFootage, db.StatePostProcessingValidation,sw ,err)
-        os.Exit(1)
-    }
-
-    uploadConfig := &s3.UploadManagerConfig{
-        MaxWorkers: runtime.NumCPU(),
-        BufferSize: 1000,
-    }
-
-    uploadManager := s3.NewUploadManager(
-        s3ContentClient,
-        task.UserID,
-        task.AssetID,
-        config.ContentBucket,
-        uploadConfig,
-    )
-
-    transcodedDir := filepath.Join(workDir, "transcoded")
     fileCount, err := uploadManager.UploadAllParallel(transcodedDir)
     if err != nil {
         log.Printf("Upload failed after processing %d files: %v", fileCount, err)
@@ -272,7 +1066,7 @@ func processTask(ctx context.Context, task Task, config *Config) error {
 
     // Upload Completion.json
     sw = NewStopWatch("UploadCompletion")
-    completionKey := filepath.Join(task.UserID, task.AssetID, config.CompletionTrigger)
+    completionKey := path.Join(task.UserID, task.AssetID, config.CompletionTrigger)
     completionData := createCompletionJSON(task.UserID, task.AssetID, fileCount)
 
     if err := s3ContentClient.UploadFile(completionKey,completionData,"application/json"); err != nil {
@@ -280,6 +1074,13 @@ func processTask(ctx context.Context, task Task, config *Config) error {
         os.Exit(1)
     }
     sw.Stop()
+
+    if signature != nil && reusable(task) {
+        entry := fingerprint.Entry{ID: path.Join(task.UserID, task.AssetID), Variant: variant, Signature: signature}
+        if err := config.FingerprintIndex.Add(ctx, entry); err != nil {
+            log.Printf("Failed to index fingerprint: %v", err)
+        }
+    }
     return nil
 }
 
@@ -4,6 +4,8 @@ go 1.21
 
 toolchain go1.23.0
 
+require gopkg.in/yaml.v3 v3.0.1
+
 require (
 	github.com/aws/aws-sdk-go-v2 v1.34.0 // indirect
 	github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream v1.6.8 // indirect
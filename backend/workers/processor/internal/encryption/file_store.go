@@ -0,0 +1,48 @@
+package encryption
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+)
+
+type FileKeyStore struct {
+    dir string
+}
+
+func NewFileKeyStore(dir string) (*FileKeyStore, error) {
+    if err := os.MkdirAll(dir, 0700); err != nil {
+        return nil, fmt.Errorf("failed to create key store directory: %v", err)
+    }
+    return &FileKeyStore{dir: dir}, nil
+}
+
+func (s *FileKeyStore) StoreKey(ctx context.Context, assetID string, key WrappedKey) error {
+    data, err := json.MarshalIndent(key, "", "  ")
+    if err != nil {
+        return fmt.Errorf("failed to encode key: %v", err)
+    }
+    if err := os.WriteFile(s.path(assetID), data, 0600); err != nil {
+        return fmt.Errorf("failed to store key: %v", err)
+    }
+    return nil
+}
+
+func (s *FileKeyStore) LoadKey(assetID string) (*WrappedKey, error) {
+    data, err := os.ReadFile(s.path(assetID))
+    if err != nil {
+        return nil, fmt.Errorf("failed to read key: %v", err)
+    }
+
+    var key WrappedKey
+    if err := json.Unmarshal(data, &key); err != nil {
+        return nil, fmt.Errorf("failed to decode key: %v", err)
+    }
+    return &key, nil
+}
+
+func (s *FileKeyStore) path(assetID string) string {
+    return filepath.Join(s.dir, fmt.Sprintf("%s.json", filepath.Base(assetID)))
+}
\ No newline at end of file
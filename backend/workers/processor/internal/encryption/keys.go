@@ -0,0 +1,129 @@
+package encryption
+
+import (
+    "context"
+    "crypto/aes"
+    "crypto/rand"
+    "encoding/binary"
+    "encoding/hex"
+    "fmt"
+    "strings"
+)
+
+type ContentKey struct {
+    KeyID []byte
+    Key   []byte
+    IV    []byte
+}
+
+type WrappedKey struct {
+    KeyID      string
+    Method     string
+    IV         string
+    WrappedKey string
+}
+
+type KeyStore interface {
+    StoreKey(ctx context.Context, assetID string, key WrappedKey) error
+}
+
+func GenerateContentKey() (*ContentKey, error) {
+    key := &ContentKey{
+        KeyID: make([]byte, 16),
+        Key:   make([]byte, 16),
+        IV:    make([]byte, 16),
+    }
+
+    for _, buf := range [][]byte{key.KeyID, key.Key, key.IV} {
+        if _, err := rand.Read(buf); err != nil {
+            return nil, fmt.Errorf("failed to generate content key: %v", err)
+        }
+    }
+
+    return key, nil
+}
+
+func (k *ContentKey) KeyIDHex() string {
+    return hex.EncodeToString(k.KeyID)
+}
+
+func (k *ContentKey) KeyHex() string {
+    return hex.EncodeToString(k.Key)
+}
+
+func (k *ContentKey) IVHex() string {
+    return hex.EncodeToString(k.IV)
+}
+
+func (k *ContentKey) Wrap(method string, kek []byte) (WrappedKey, error) {
+    wrapped, err := WrapKey(kek, k.Key)
+    if err != nil {
+        return WrappedKey{}, err
+    }
+
+    return WrappedKey{
+        KeyID:      k.KeyIDHex(),
+        Method:     method,
+        IV:         k.IVHex(),
+        WrappedKey: hex.EncodeToString(wrapped),
+    }, nil
+}
+
+// WrapKey implements the AES key wrap algorithm from RFC 3394.
+func WrapKey(kek, key []byte) ([]byte, error) {
+    if len(key)%8 != 0 || len(key) < 16 {
+        return nil, fmt.Errorf("key length must be a multiple of 8 and at least 16 bytes")
+    }
+
+    block, err := aes.NewCipher(kek)
+    if err != nil {
+        return nil, fmt.Errorf("invalid key encryption key: %v", err)
+    }
+
+    n := len(key) / 8
+    a := []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+    r := make([][]byte, n)
+    for i := range r {
+        r[i] = append([]byte{}, key[i*8:(i+1)*8]...)
+    }
+
+    buf := make([]byte, 16)
+    for j := 0; j < 6; j++ {
+        for i := 0; i < n; i++ {
+            copy(buf[:8], a)
+            copy(buf[8:], r[i])
+            block.Encrypt(buf, buf)
+
+            t := uint64(n*j + i + 1)
+            binary.BigEndian.PutUint64(a, binary.BigEndian.Uint64(buf[:8])^t)
+            copy(r[i], buf[8:])
+        }
+    }
+
+    wrapped := append([]byte{}, a...)
+    for _, chunk := range r {
+        wrapped = append(wrapped, chunk...)
+    }
+    return wrapped, nil
+}
+
+func ParseHexKey(value string) ([]byte, error) {
+    key, err := hex.DecodeString(strings.TrimSpace(value))
+    if err != nil {
+        return nil, fmt.Errorf("invalid hex key: %v", err)
+    }
+    switch len(key) {
+    case 16, 24, 32:
+        return key, nil
+    default:
+        return nil, fmt.Errorf("invalid key length %d", len(key))
+    }
+}
+
+func ExpandKeyURL(template, userID, assetID, keyID string) string {
+    return strings.NewReplacer(
+        "{userId}", userID,
+        "{assetId}", assetID,
+        "{keyId}", keyID,
+    ).Replace(template)
+}
\ No newline at end of file
@@ -0,0 +1,127 @@
+package fingerprint
+
+import (
+    "encoding/binary"
+    "fmt"
+    "math"
+    "math/cmplx"
+    "os/exec"
+)
+
+const (
+    audioSampleRate = 5512
+    audioWindow     = 2048
+    audioHop        = 512
+    audioMaxSeconds = 120
+    audioBands      = 33
+    audioMinFreq    = 300.0
+    audioMaxFreq    = 2000.0
+)
+
+// audioFingerprint derives one 32-bit sub-fingerprint per hop from the sign of
+// energy differences between adjacent bands across consecutive frames, as in
+// the Philips robust hash. Each bit survives re-encoding and volume changes.
+func audioFingerprint(inputPath string, stream int) ([]uint32, error) {
+    cmd := exec.Command("ffmpeg",
+        "-v", "error",
+        "-i", inputPath,
+        "-map", fmt.Sprintf("0:a:%d", stream),
+        "-t", fmt.Sprintf("%d", audioMaxSeconds),
+        "-ac", "1",
+        "-ar", fmt.Sprintf("%d", audioSampleRate),
+        "-f", "s16le",
+        "-")
+    raw, err := cmd.Output()
+    if err != nil {
+        return nil, fmt.Errorf("failed to decode audio: %v", err)
+    }
+
+    samples := make([]float64, len(raw)/2)
+    for i := range samples {
+        samples[i] = float64(int16(binary.LittleEndian.Uint16(raw[i*2:])))
+    }
+
+    edges := bandEdges()
+    window := hannWindow(audioWindow)
+    var previous []float64
+    var hashes []uint32
+
+    for start := 0; start+audioWindow <= len(samples); start += audioHop {
+        frame := make([]complex128, audioWindow)
+        for i := range frame {
+            frame[i] = complex(samples[start+i]*window[i], 0)
+        }
+        spectrum := fft(frame)
+
+        energies := make([]float64, audioBands)
+        for band := 0; band < audioBands; band++ {
+            for bin := edges[band]; bin < edges[band+1]; bin++ {
+                magnitude := cmplx.Abs(spectrum[bin])
+                energies[band] += magnitude * magnitude
+            }
+        }
+
+        if previous != nil {
+            var hash uint32
+            for band := 0; band < audioBands-1; band++ {
+                hash <<= 1
+                if (energies[band]-energies[band+1])-(previous[band]-previous[band+1]) > 0 {
+                    hash |= 1
+                }
+            }
+            hashes = append(hashes, hash)
+        }
+        previous = energies
+    }
+
+    return hashes, nil
+}
+
+func bandEdges() []int {
+    edges := make([]int, audioBands+1)
+    ratio := math.Pow(audioMaxFreq/audioMinFreq, 1.0/audioBands)
+    for i := range edges {
+        frequency := audioMinFreq * math.Pow(ratio, float64(i))
+        edges[i] = int(frequency * audioWindow / audioSampleRate)
+    }
+    return edges
+}
+
+func hannWindow(size int) []float64 {
+    window := make([]float64, size)
+    for i := range window {
+        window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(size-1))
+    }
+    return window
+}
+
+// fft is an in-place iterative radix-2 transform; len(values) must be a
+// power of two.
+func fft(values []complex128) []complex128 {
+    n := len(values)
+    for i, j := 1, 0; i < n; i++ {
+        bit := n >> 1
+        for ; j&bit != 0; bit >>= 1 {
+            j ^= bit
+        }
+        j ^= bit
+        if i < j {
+            values[i], values[j] = values[j], values[i]
+        }
+    }
+
+    for length := 2; length <= n; length <<= 1 {
+        step := cmplx.Exp(complex(0, -2*math.Pi/float64(length)))
+        for start := 0; start < n; start += length {
+            w := complex(1, 0)
+            for k := 0; k < length/2; k++ {
+                even := values[start+k]
+                odd := values[start+k+length/2] * w
+                values[start+k] = even + odd
+                values[start+k+length/2] = even - odd
+                w *= step
+            }
+        }
+    }
+    return values
+}
\ No newline at end of file
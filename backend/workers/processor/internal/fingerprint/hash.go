@@ -0,0 +1,123 @@
+package fingerprint
+
+import (
+    "fmt"
+    "math"
+    "math/bits"
+    "os/exec"
+    "sort"
+)
+
+const (
+    frameSamples = 16
+    frameSize    = 32
+)
+
+type FrameHash struct {
+    DHash uint64
+    PHash uint64
+}
+
+// sampleFrames grabs evenly spaced frames as 32x32 grayscale. Seeking to
+// fractions of the duration keeps samples aligned between two uploads of the
+// same clip regardless of container differences.
+func sampleFrames(inputPath string, duration float64) ([]FrameHash, error) {
+    hashes := make([]FrameHash, 0, frameSamples)
+    for i := 0; i < frameSamples; i++ {
+        at := duration * (float64(i) + 0.5) / frameSamples
+        cmd := exec.Command("ffmpeg",
+            "-v", "error",
+            "-ss", fmt.Sprintf("%.3f", at),
+            "-i", inputPath,
+            "-frames:v", "1",
+            "-vf", fmt.Sprintf("scale=%d:%d:flags=area,format=gray", frameSize, frameSize),
+            "-f", "rawvideo",
+            "-")
+        pixels, err := cmd.Output()
+        if err != nil {
+            return nil, fmt.Errorf("failed to sample frame at %.3fs: %v", at, err)
+        }
+        if len(pixels) < frameSize*frameSize {
+            return nil, fmt.Errorf("short frame at %.3fs", at)
+        }
+
+        pixels = pixels[:frameSize*frameSize]
+        hashes = append(hashes, FrameHash{
+            DHash: dHash(pixels),
+            PHash: pHash(pixels),
+        })
+    }
+    return hashes, nil
+}
+
+// dHash compares each cell of a 9x8 reduction with its right neighbour.
+func dHash(pixels []byte) uint64 {
+    small := resize(pixels, frameSize, frameSize, 9, 8)
+    var hash uint64
+    for y := 0; y < 8; y++ {
+        for x := 0; x < 8; x++ {
+            hash <<= 1
+            if small[y*9+x] > small[y*9+x+1] {
+                hash |= 1
+            }
+        }
+    }
+    return hash
+}
+
+// pHash thresholds the low-frequency 8x8 DCT coefficients, skipping the DC
+// term, against their median.
+func pHash(pixels []byte) uint64 {
+    coefficients := make([]float64, 0, 64)
+    for v := 0; v < 8; v++ {
+        for u := 0; u < 8; u++ {
+            sum := 0.0
+            for y := 0; y < frameSize; y++ {
+                for x := 0; x < frameSize; x++ {
+                    sum += float64(pixels[y*frameSize+x]) *
+                        math.Cos(float64(2*x+1)*float64(u)*math.Pi/(2*frameSize)) *
+                        math.Cos(float64(2*y+1)*float64(v)*math.Pi/(2*frameSize))
+                }
+            }
+            coefficients = append(coefficients, sum)
+        }
+    }
+
+    median := medianOf(coefficients[1:])
+    var hash uint64
+    for _, coefficient := range coefficients {
+        hash <<= 1
+        if coefficient > median {
+            hash |= 1
+        }
+    }
+    return hash
+}
+
+func resize(pixels []byte, width, height, toWidth, toHeight int) []float64 {
+    out := make([]float64, toWidth*toHeight)
+    for ty := 0; ty < toHeight; ty++ {
+        y0, y1 := ty*height/toHeight, (ty+1)*height/toHeight
+        for tx := 0; tx < toWidth; tx++ {
+            x0, x1 := tx*width/toWidth, (tx+1)*width/toWidth
+            sum := 0.0
+            for y := y0; y < y1; y++ {
+                for x := x0; x < x1; x++ {
+                    sum += float64(pixels[y*width+x])
+                }
+            }
+            out[ty*toWidth+tx] = sum / float64((y1-y0)*(x1-x0))
+        }
+    }
+    return out
+}
+
+func medianOf(values []float64) float64 {
+    sorted := append([]float64(nil), values...)
+    sort.Float64s(sorted)
+    return sorted[len(sorted)/2]
+}
+
+func hamming(a, b uint64) int {
+    return bits.OnesCount64(a ^ b)
+}
\ No newline at end of file
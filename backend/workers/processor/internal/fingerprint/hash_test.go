@@ -0,0 +1,88 @@
+package fingerprint
+
+import "testing"
+
+// frame builds a frameSize square frame from a function of the pixel position.
+func frame(pixel func(x, y int) int) []byte {
+    pixels := make([]byte, frameSize*frameSize)
+    for y := 0; y < frameSize; y++ {
+        for x := 0; x < frameSize; x++ {
+            pixels[y*frameSize+x] = byte(pixel(x, y))
+        }
+    }
+    return pixels
+}
+
+func TestDHash(t *testing.T) {
+    tests := []struct {
+        name   string
+        pixels []byte
+        hash   uint64
+    }{
+        {name: "brightening to the right", pixels: frame(func(x, y int) int { return x * 8 }), hash: 0},
+        {name: "darkening to the right", pixels: frame(func(x, y int) int { return 255 - x*8 }), hash: ^uint64(0)},
+        {name: "flat", pixels: frame(func(x, y int) int { return 128 }), hash: 0},
+        {name: "dark left half", pixels: frame(func(x, y int) int {
+            if x < frameSize/2 {
+                return 255
+            }
+            return 0
+        }), hash: 0x1818181818181818},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            if hash := dHash(test.pixels); hash != test.hash {
+                t.Errorf("dHash = %016x, want %016x", hash, test.hash)
+            }
+        })
+    }
+}
+
+func TestPHash(t *testing.T) {
+    // A textured picture, so no coefficient is near the median by accident.
+    texture := func(x, y int) int { return (x*73 + y*151 + x*y*7) % 97 }
+    picture := frame(func(x, y int) int { return 40 + texture(x, y) })
+    mirrored := frame(func(x, y int) int { return 40 + texture(frameSize-1-x, y) })
+    checker := frame(func(x, y int) int { return 40 + ((x/4+y/4)%2)*150 })
+
+    tests := []struct {
+        name    string
+        a, b    []byte
+        maxBits int
+        minBits int
+    }{
+        {name: "identical", a: picture, b: picture, maxBits: 0},
+        {name: "brighter", a: picture, b: frame(func(x, y int) int { return 80 + texture(x, y) }), maxBits: 0},
+        {name: "higher contrast", a: picture, b: frame(func(x, y int) int { return 20 + texture(x, y)*2 }), maxBits: 0},
+        {name: "mirrored", a: picture, b: mirrored, minBits: 8, maxBits: 64},
+        {name: "different picture", a: picture, b: checker, minBits: 8, maxBits: 64},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            bits := hamming(pHash(test.a), pHash(test.b))
+            if bits < test.minBits || bits > test.maxBits {
+                t.Errorf("pHashes differ in %d bits, want %d to %d", bits, test.minBits, test.maxBits)
+            }
+        })
+    }
+}
+
+func TestHamming(t *testing.T) {
+    tests := []struct {
+        a, b uint64
+        want int
+    }{
+        {a: 0, b: 0, want: 0},
+        {a: 0, b: ^uint64(0), want: 64},
+        {a: 0xf0, b: 0x0f, want: 8},
+        {a: 1 << 63, b: 1, want: 2},
+    }
+
+    for _, test := range tests {
+        if got := hamming(test.a, test.b); got != test.want {
+            t.Errorf("hamming(%x, %x) = %d, want %d", test.a, test.b, got, test.want)
+        }
+    }
+}
\ No newline at end of file
@@ -0,0 +1,60 @@
+package fingerprint
+
+import (
+    "context"
+    "sort"
+    "sync"
+)
+
+// Entry is an indexed asset. Variant describes the options its outputs were
+// produced with, so a match is only reused for a task that asks for the same
+// outputs.
+type Entry struct {
+    ID        string
+    Variant   string
+    Signature *Signature
+}
+
+type Match struct {
+    ID       string
+    Distance float64
+}
+
+type Index interface {
+    Add(ctx context.Context, entry Entry) error
+    Find(ctx context.Context, signature *Signature, variant string, maxDistance float64) ([]Match, error)
+}
+
+type MemoryIndex struct {
+    mu      sync.RWMutex
+    entries []Entry
+}
+
+func NewMemoryIndex() *MemoryIndex {
+    return &MemoryIndex{}
+}
+
+func (m *MemoryIndex) Add(ctx context.Context, entry Entry) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.entries = append(m.entries, entry)
+    return nil
+}
+
+func (m *MemoryIndex) Find(ctx context.Context, signature *Signature, variant string, maxDistance float64) ([]Match, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+
+    var matches []Match
+    for _, entry := range m.entries {
+        if entry.Variant != variant {
+            continue
+        }
+        if distance := Distance(signature, entry.Signature); distance <= maxDistance {
+            matches = append(matches, Match{ID: entry.ID, Distance: distance})
+        }
+    }
+
+    sort.Slice(matches, func(i, j int) bool { return matches[i].Distance < matches[j].Distance })
+    return matches, nil
+}
\ No newline at end of file
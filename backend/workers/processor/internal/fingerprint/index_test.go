@@ -0,0 +1,56 @@
+package fingerprint
+
+import (
+    "context"
+    "testing"
+)
+
+func TestMemoryIndexFind(t *testing.T) {
+    ctx := context.Background()
+    index := NewMemoryIndex()
+    entries := []Entry{
+        {ID: "user/far", Variant: "hls", Signature: signature(30, 16, 0xffffffffffff0000)},
+        {ID: "user/exact", Variant: "hls", Signature: signature(30, 16, 0xffff0000ffff0000)},
+        {ID: "user/near", Variant: "hls", Signature: signature(30, 16, 0xffff0000ffff0001)},
+        {ID: "user/other-variant", Variant: "vertical", Signature: signature(30, 16, 0xffff0000ffff0000)},
+    }
+    for _, entry := range entries {
+        if err := index.Add(ctx, entry); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    tests := []struct {
+        name        string
+        variant     string
+        maxDistance float64
+        want        []string
+    }{
+        {name: "closest first", variant: "hls", maxDistance: 0.3, want: []string{"user/exact", "user/near", "user/far"}},
+        {name: "within the distance", variant: "hls", maxDistance: 0.1, want: []string{"user/exact", "user/near"}},
+        {name: "other variant", variant: "vertical", maxDistance: 0.3, want: []string{"user/other-variant"}},
+        {name: "unknown variant", variant: "dash", maxDistance: 1},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            matches, err := index.Find(ctx, signature(30, 16, 0xffff0000ffff0000), test.variant, test.maxDistance)
+            if err != nil {
+                t.Fatal(err)
+            }
+            var ids []string
+            for _, match := range matches {
+                ids = append(ids, match.ID)
+            }
+            if len(ids) != len(test.want) {
+                t.Fatalf("Find = %v, want %v", ids, test.want)
+            }
+            for i := range ids {
+                if ids[i] != test.want[i] {
+                    t.Errorf("Find = %v, want %v", ids, test.want)
+                    break
+                }
+            }
+        })
+    }
+}
\ No newline at end of file
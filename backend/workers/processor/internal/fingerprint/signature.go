@@ -0,0 +1,96 @@
+package fingerprint
+
+import (
+    "fmt"
+    "math"
+    "math/bits"
+    "strings"
+)
+
+// maxDurationDelta is how far apart two durations may be and still be
+// considered the same upload.
+const maxDurationDelta = 1.0
+
+type Signature struct {
+    Duration float64
+    Frames   []FrameHash
+    Audio    []uint32
+}
+
+// Compute fingerprints a media file. audioStream is the audio stream to
+// hash, or -1 for sources without audio.
+func Compute(inputPath string, duration float64, audioStream int) (*Signature, error) {
+    if duration <= 0 {
+        return nil, fmt.Errorf("cannot fingerprint media without a duration")
+    }
+
+    frames, err := sampleFrames(inputPath, duration)
+    if err != nil {
+        return nil, err
+    }
+
+    signature := &Signature{Duration: duration, Frames: frames}
+    if audioStream >= 0 {
+        if signature.Audio, err = audioFingerprint(inputPath, audioStream); err != nil {
+            return nil, err
+        }
+    }
+    return signature, nil
+}
+
+// Distance is 0 for identical signatures and 1 for unrelated ones. Video and
+// audio contribute equally when both clips have sound.
+func Distance(a, b *Signature) float64 {
+    if math.Abs(a.Duration-b.Duration) > maxDurationDelta || len(a.Frames) != len(b.Frames) || len(a.Frames) == 0 {
+        return 1
+    }
+
+    video := 0.0
+    for i := range a.Frames {
+        video += float64(hamming(a.Frames[i].PHash, b.Frames[i].PHash)+hamming(a.Frames[i].DHash, b.Frames[i].DHash)) / 128
+    }
+    video /= float64(len(a.Frames))
+
+    if len(a.Audio) == 0 && len(b.Audio) == 0 {
+        return video
+    }
+    if len(a.Audio) == 0 || len(b.Audio) == 0 {
+        return 1
+    }
+
+    count := len(a.Audio)
+    if len(b.Audio) < count {
+        count = len(b.Audio)
+    }
+    differing := 0
+    for i := 0; i < count; i++ {
+        differing += bits.OnesCount32(a.Audio[i] ^ b.Audio[i])
+    }
+    audio := float64(differing) / float64(count*32)
+
+    return (video + audio) / 2
+}
+
+func (s *Signature) DHashes() []string {
+    hashes := make([]string, len(s.Frames))
+    for i, frame := range s.Frames {
+        hashes[i] = fmt.Sprintf("%016x", frame.DHash)
+    }
+    return hashes
+}
+
+func (s *Signature) PHashes() []string {
+    hashes := make([]string, len(s.Frames))
+    for i, frame := range s.Frames {
+        hashes[i] = fmt.Sprintf("%016x", frame.PHash)
+    }
+    return hashes
+}
+
+func (s *Signature) AudioHex() string {
+    var builder strings.Builder
+    for _, hash := range s.Audio {
+        fmt.Fprintf(&builder, "%08x", hash)
+    }
+    return builder.String()
+}
\ No newline at end of file
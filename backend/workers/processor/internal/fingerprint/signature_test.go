@@ -0,0 +1,54 @@
+package fingerprint
+
+import (
+    "math"
+    "testing"
+)
+
+func signature(duration float64, frames int, hash uint64, audio ...uint32) *Signature {
+    s := &Signature{Duration: duration, Audio: audio}
+    for i := 0; i < frames; i++ {
+        s.Frames = append(s.Frames, FrameHash{DHash: hash, PHash: hash})
+    }
+    return s
+}
+
+func TestDistance(t *testing.T) {
+    base := signature(30, 16, 0xffff0000ffff0000)
+
+    tests := []struct {
+        name string
+        a, b *Signature
+        want float64
+    }{
+        {name: "identical", a: base, b: base, want: 0},
+        {name: "durations within a second", a: base, b: signature(30.8, 16, 0xffff0000ffff0000), want: 0},
+        {name: "durations too far apart", a: base, b: signature(31.5, 16, 0xffff0000ffff0000), want: 1},
+        {name: "different frame counts", a: base, b: signature(30, 8, 0xffff0000ffff0000), want: 1},
+        {name: "no frames", a: signature(30, 0, 0), b: signature(30, 0, 0), want: 1},
+        // Both hashes of every frame differ in 16 of 64 bits.
+        {name: "some bits differ", a: base, b: signature(30, 16, 0xffffffffffff0000), want: 0.25},
+        {name: "inverted frames", a: base, b: signature(30, 16, 0x0000ffff0000ffff), want: 1},
+        {name: "only one has audio", a: base, b: signature(30, 16, 0xffff0000ffff0000, 1, 2), want: 1},
+        {
+            name: "matching video, half the audio bits differ",
+            a:    signature(30, 16, 0xffff0000ffff0000, 0x00000000, 0xffffffff),
+            b:    signature(30, 16, 0xffff0000ffff0000, 0xffff0000, 0xffff0000),
+            want: 0.25,
+        },
+        {
+            name: "audio compared over the shorter clip",
+            a:    signature(30, 16, 0xffff0000ffff0000, 0xffffffff),
+            b:    signature(30, 16, 0xffff0000ffff0000, 0xffffffff, 0x00000000),
+            want: 0,
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            if got := Distance(test.a, test.b); math.Abs(got-test.want) > 1e-9 {
+                t.Errorf("Distance = %.4f, want %.4f", got, test.want)
+            }
+        })
+    }
+}
\ No newline at end of file
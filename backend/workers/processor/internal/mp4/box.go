@@ -0,0 +1,97 @@
+package mp4
+
+import (
+    "encoding/binary"
+    "fmt"
+)
+
+// Box is an ISO BMFF box located inside a byte slice. Offset is the position
+// of the box header, and Payload the bytes following the header.
+type Box struct {
+    Type    string
+    Offset  int64
+    Size    int64
+    Payload []byte
+}
+
+// ReadBoxes splits data into consecutive boxes. base is the absolute offset
+// of data within its file, so nested boxes keep file positions.
+func ReadBoxes(data []byte, base int64) ([]Box, error) {
+    var boxes []Box
+    for position := int64(0); position < int64(len(data)); {
+        if int64(len(data))-position < 8 {
+            return nil, fmt.Errorf("truncated box header at %d", base+position)
+        }
+
+        size := int64(binary.BigEndian.Uint32(data[position:]))
+        boxType := string(data[position+4 : position+8])
+        header := int64(8)
+
+        switch size {
+        case 0:
+            size = int64(len(data)) - position
+        case 1:
+            if int64(len(data))-position < 16 {
+                return nil, fmt.Errorf("truncated large box header at %d", base+position)
+            }
+            size = int64(binary.BigEndian.Uint64(data[position+8:]))
+            header = 16
+        }
+
+        if size < header || position+size > int64(len(data)) {
+            return nil, fmt.Errorf("invalid %s box size %d at %d", boxType, size, base+position)
+        }
+
+        boxes = append(boxes, Box{
+            Type:    boxType,
+            Offset:  base + position,
+            Size:    size,
+            Payload: data[position+header : position+size],
+        })
+        position += size
+    }
+    return boxes, nil
+}
+
+// Children parses the payload of a container box.
+func (b Box) Children() ([]Box, error) {
+    return ReadBoxes(b.Payload, b.Offset+(b.Size-int64(len(b.Payload))))
+}
+
+// Find walks a path of box types, such as "moov", "trak", returning every
+// match at the final level.
+func Find(boxes []Box, path ...string) ([]Box, error) {
+    if len(path) == 0 {
+        return boxes, nil
+    }
+
+    var found []Box
+    for _, box := range boxes {
+        if box.Type != path[0] {
+            continue
+        }
+        if len(path) == 1 {
+            found = append(found, box)
+            continue
+        }
+        children, err := box.Children()
+        if err != nil {
+            return nil, err
+        }
+        nested, err := Find(children, path[1:]...)
+        if err != nil {
+            return nil, err
+        }
+        found = append(found, nested...)
+    }
+    return found, nil
+}
+
+// fullBox splits a full box payload into version, flags and body.
+func fullBox(box Box) (uint8, uint32, []byte, error) {
+    if len(box.Payload) < 4 {
+        return 0, 0, nil, fmt.Errorf("truncated %s box", box.Type)
+    }
+    header := binary.BigEndian.Uint32(box.Payload)
+    return uint8(header >> 24), header & 0xffffff, box.Payload[4:], nil
+}
\ No newline at end of file
@@ -0,0 +1,126 @@
+package mp4
+
+import (
+    "bytes"
+    "encoding/binary"
+    "strings"
+    "testing"
+)
+
+func u32(value uint32) []byte {
+    return binary.BigEndian.AppendUint32(nil, value)
+}
+
+func u64(value uint64) []byte {
+    return binary.BigEndian.AppendUint64(nil, value)
+}
+
+// box builds a box with a 32-bit size from its payload parts.
+func box(boxType string, parts ...[]byte) []byte {
+    payload := bytes.Join(parts, nil)
+    return append(append(u32(uint32(8+len(payload))), boxType...), payload...)
+}
+
+// full builds a full box, prefixing the payload with version and flags.
+func full(boxType string, version uint8, flags uint32, parts ...[]byte) []byte {
+    return box(boxType, append([][]byte{u32(uint32(version)<<24 | flags)}, parts...)...)
+}
+
+func TestReadBoxes(t *testing.T) {
+    large := append(append(u32(1), "mdat"...), u64(20)...)
+    large = append(large, 1, 2, 3, 4)
+    toEnd := append(append(u32(0), "mdat"...), 5, 6, 7)
+
+    tests := []struct {
+        name    string
+        data    []byte
+        base    int64
+        want    []Box
+        problem string
+    }{
+        {
+            name: "consecutive boxes",
+            data: append(box("ftyp", []byte("isom")), box("free")...),
+            want: []Box{
+                {Type: "ftyp", Offset: 0, Size: 12, Payload: []byte("isom")},
+                {Type: "free", Offset: 12, Size: 8, Payload: []byte{}},
+            },
+        },
+        {
+            name: "offsets relative to base",
+            data: box("moof", []byte{9}),
+            base: 100,
+            want: []Box{{Type: "moof", Offset: 100, Size: 9, Payload: []byte{9}}},
+        },
+        {
+            name: "64-bit size",
+            data: append(box("moof"), large...),
+            want: []Box{
+                {Type: "moof", Offset: 0, Size: 8, Payload: []byte{}},
+                {Type: "mdat", Offset: 8, Size: 20, Payload: []byte{1, 2, 3, 4}},
+            },
+        },
+        {
+            name: "size 0 runs to the end",
+            data: append(box("moof"), toEnd...),
+            want: []Box{
+                {Type: "moof", Offset: 0, Size: 8, Payload: []byte{}},
+                {Type: "mdat", Offset: 8, Size: 11, Payload: []byte{5, 6, 7}},
+            },
+        },
+        {name: "truncated header", data: append(box("moof"), 0, 0, 0), problem: "truncated box header at 8"},
+        {name: "truncated 64-bit header", data: large[:12], problem: "truncated large box header at 0"},
+        {name: "size below the header", data: append(u32(4), "moof"...), problem: "invalid moof box size 4"},
+        {name: "64-bit size below the header", data: append(append(u32(1), "mdat"...), u64(12)...), problem: "invalid mdat box size 12"},
+        {name: "size past the data", data: box("moof", []byte{1, 2})[:9], problem: "invalid moof box size 10"},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            boxes, err := ReadBoxes(test.data, test.base)
+            if test.problem != "" {
+                if err == nil || !strings.Contains(err.Error(), test.problem) {
+                    t.Errorf("ReadBoxes = %v, want %q", err, test.problem)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if len(boxes) != len(test.want) {
+                t.Fatalf("ReadBoxes returned %d boxes, want %d", len(boxes), len(test.want))
+            }
+            for i, want := range test.want {
+                got := boxes[i]
+                if got.Type != want.Type || got.Offset != want.Offset || got.Size != want.Size || !bytes.Equal(got.Payload, want.Payload) {
+                    t.Errorf("box %d = %+v, want %+v", i, got, want)
+                }
+            }
+        })
+    }
+}
+
+func TestFindKeepsFileOffsets(t *testing.T) {
+    // The outer box uses a 64-bit size, so its children start 16 bytes in.
+    traf := box("traf", box("tfhd", []byte{1}), box("trun", []byte{2}))
+    moof := append(append(u32(1), "moof"...), u64(uint64(16+len(traf)))...)
+    moof = append(moof, traf...)
+    data := append(box("styp"), moof...)
+
+    boxes, err := ReadBoxes(data, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    truns, err := Find(boxes, "moof", "traf", "trun")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(truns) != 1 || truns[0].Offset != 8+16+8+9 || truns[0].Payload[0] != 2 {
+        t.Errorf("Find = %+v, want the trun at offset %d", truns, 8+16+8+9)
+    }
+
+    missing, err := Find(boxes, "moov", "trak")
+    if err != nil || len(missing) != 0 {
+        t.Errorf("Find = %v, %v; want no boxes", missing, err)
+    }
+}
\ No newline at end of file
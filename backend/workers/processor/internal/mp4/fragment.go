@@ -0,0 +1,295 @@
+package mp4
+
+import (
+    "encoding/binary"
+    "fmt"
+)
+
+const (
+    tfhdBaseDataOffset    = 0x000001
+    tfhdSampleDescription = 0x000002
+    tfhdDefaultDuration   = 0x000008
+    tfhdDefaultSize       = 0x000010
+    tfhdDefaultFlags      = 0x000020
+
+    trunDataOffset       = 0x000001
+    trunFirstSampleFlags = 0x000004
+    trunSampleDuration   = 0x000100
+    trunSampleSize       = 0x000200
+    trunSampleFlags      = 0x000400
+    trunCompositionTime  = 0x000800
+
+    sampleIsNonSync = 0x00010000
+)
+
+// Track describes one track of a fragmented MP4 initialization segment.
+type Track struct {
+    ID              uint32
+    Handler         string
+    Timescale       uint32
+    DefaultDuration uint32
+    DefaultSize     uint32
+    DefaultFlags    uint32
+}
+
+// Sample is a media sample inside a fragment. Offset is absolute within the
+// segment file, and MoofOffset points at the fragment that describes it.
+type Sample struct {
+    DecodeTime uint64
+    Duration   uint32
+    Offset     int64
+    Size       uint32
+    Sync       bool
+    MoofOffset int64
+}
+
+// ReadTracks lists the tracks in an initialization segment along with the
+// sample defaults from mvex/trex.
+func ReadTracks(init []byte) ([]Track, error) {
+    boxes, err := ReadBoxes(init, 0)
+    if err != nil {
+        return nil, err
+    }
+
+    traks, err := Find(boxes, "moov", "trak")
+    if err != nil {
+        return nil, err
+    }
+    trexes, err := Find(boxes, "moov", "mvex", "trex")
+    if err != nil {
+        return nil, err
+    }
+
+    var tracks []Track
+    for _, trak := range traks {
+        children, err := trak.Children()
+        if err != nil {
+            return nil, err
+        }
+
+        var track Track
+        tkhd, err := Find(children, "tkhd")
+        if err != nil || len(tkhd) == 0 {
+            return nil, fmt.Errorf("track without tkhd")
+        }
+        version, _, body, err := fullBox(tkhd[0])
+        if err != nil {
+            return nil, err
+        }
+        // track_ID follows the creation and modification times.
+        idOffset := 8
+        if version == 1 {
+            idOffset = 16
+        }
+        if len(body) < idOffset+4 {
+            return nil, fmt.Errorf("truncated tkhd box")
+        }
+        track.ID = binary.BigEndian.Uint32(body[idOffset:])
+
+        mdhd, err := Find(children, "mdia", "mdhd")
+        if err != nil || len(mdhd) == 0 {
+            return nil, fmt.Errorf("track %d without mdhd", track.ID)
+        }
+        version, _, body, err = fullBox(mdhd[0])
+        if err != nil {
+            return nil, err
+        }
+        scaleOffset := 8
+        if version == 1 {
+            scaleOffset = 16
+        }
+        if len(body) < scaleOffset+4 {
+            return nil, fmt.Errorf("truncated mdhd box")
+        }
+        track.Timescale = binary.BigEndian.Uint32(body[scaleOffset:])
+
+        hdlr, err := Find(children, "mdia", "hdlr")
+        if err == nil && len(hdlr) > 0 {
+            if _, _, body, err := fullBox(hdlr[0]); err == nil && len(body) >= 8 {
+                track.Handler = string(body[4:8])
+            }
+        }
+
+        for _, trex := range trexes {
+            _, _, body, err := fullBox(trex)
+            if err != nil || len(body) < 20 || binary.BigEndian.Uint32(body) != track.ID {
+                continue
+            }
+            track.DefaultDuration = binary.BigEndian.Uint32(body[8:])
+            track.DefaultSize = binary.BigEndian.Uint32(body[12:])
+            track.DefaultFlags = binary.BigEndian.Uint32(body[16:])
+        }
+
+        tracks = append(tracks, track)
+    }
+    return tracks, nil
+}
+
+// ReadSamples lists the samples of one track across every fragment of a
+// media segment.
+func ReadSamples(segment []byte, track Track) ([]Sample, error) {
+    boxes, err := ReadBoxes(segment, 0)
+    if err != nil {
+        return nil, err
+    }
+
+    var samples []Sample
+    for _, moof := range boxes {
+        if moof.Type != "moof" {
+            continue
+        }
+        trafs, err := Find([]Box{moof}, "moof", "traf")
+        if err != nil {
+            return nil, err
+        }
+        for _, traf := range trafs {
+            fragmentSamples, err := readTraf(traf, moof.Offset, track)
+            if err != nil {
+                return nil, err
+            }
+            samples = append(samples, fragmentSamples...)
+        }
+    }
+    return samples, nil
+}
+
+func readTraf(traf Box, moofOffset int64, track Track) ([]Sample, error) {
+    children, err := traf.Children()
+    if err != nil {
+        return nil, err
+    }
+
+    tfhds, _ := Find(children, "tfhd")
+    if len(tfhds) == 0 {
+        return nil, fmt.Errorf("traf without tfhd")
+    }
+    _, flags, body, err := fullBox(tfhds[0])
+    if err != nil || len(body) < 4 {
+        return nil, fmt.Errorf("truncated tfhd box")
+    }
+    if binary.BigEndian.Uint32(body) != track.ID {
+        return nil, nil
+    }
+
+    defaultDuration, defaultSize, defaultFlags := track.DefaultDuration, track.DefaultSize, track.DefaultFlags
+    base := moofOffset
+    reader := fieldReader{data: body[4:]}
+    if flags&tfhdBaseDataOffset != 0 {
+        base = int64(reader.uint64())
+    }
+    if flags&tfhdSampleDescription != 0 {
+        reader.uint32()
+    }
+    if flags&tfhdDefaultDuration != 0 {
+        defaultDuration = reader.uint32()
+    }
+    if flags&tfhdDefaultSize != 0 {
+        defaultSize = reader.uint32()
+    }
+    if flags&tfhdDefaultFlags != 0 {
+        defaultFlags = reader.uint32()
+    }
+    if reader.err != nil {
+        return nil, fmt.Errorf("truncated tfhd box")
+    }
+
+    var decodeTime uint64
+    if tfdts, _ := Find(children, "tfdt"); len(tfdts) > 0 {
+        version, _, body, err := fullBox(tfdts[0])
+        if err != nil {
+            return nil, err
+        }
+        reader := fieldReader{data: body}
+        if version == 1 {
+            decodeTime = reader.uint64()
+        } else {
+            decodeTime = uint64(reader.uint32())
+        }
+        if reader.err != nil {
+            return nil, fmt.Errorf("truncated tfdt box")
+        }
+    }
+
+    truns, _ := Find(children, "trun")
+    var samples []Sample
+    // Without an explicit data offset, a run continues where the previous one
+    // ended.
+    next := base
+    for _, trun := range truns {
+        _, flags, body, err := fullBox(trun)
+        if err != nil {
+            return nil, err
+        }
+        reader := fieldReader{data: body}
+        count := reader.uint32()
+        offset := next
+        if flags&trunDataOffset != 0 {
+            offset = base + int64(int32(reader.uint32()))
+        }
+        firstFlags, hasFirstFlags := uint32(0), flags&trunFirstSampleFlags != 0
+        if hasFirstFlags {
+            firstFlags = reader.uint32()
+        }
+
+        for i := uint32(0); i < count; i++ {
+            sample := Sample{
+                DecodeTime: decodeTime,
+                Duration:   defaultDuration,
+                Offset:     offset,
+                Size:       defaultSize,
+                MoofOffset: moofOffset,
+            }
+            sampleFlags := defaultFlags
+            if flags&trunSampleDuration != 0 {
+                sample.Duration = reader.uint32()
+            }
+            if flags&trunSampleSize != 0 {
+                sample.Size = reader.uint32()
+            }
+            if flags&trunSampleFlags != 0 {
+                sampleFlags = reader.uint32()
+            }
+            if flags&trunCompositionTime != 0 {
+                reader.uint32()
+            }
+            if i == 0 && hasFirstFlags {
+                sampleFlags = firstFlags
+            }
+            if reader.err != nil {
+                return nil, fmt.Errorf("truncated trun box")
+            }
+
+            sample.Sync = sampleFlags&sampleIsNonSync == 0
+            samples = append(samples, sample)
+            decodeTime += uint64(sample.Duration)
+            offset += int64(sample.Size)
+        }
+        next = offset
+    }
+    return samples, nil
+}
+
+type fieldReader struct {
+    data []byte
+    err  error
+}
+
+func (r *fieldReader) uint32() uint32 {
+    if len(r.data) < 4 {
+        r.err = fmt.Errorf("short read")
+        return 0
+    }
+    value := binary.BigEndian.Uint32(r.data)
+    r.data = r.data[4:]
+    return value
+}
+
+func (r *fieldReader) uint64() uint64 {
+    if len(r.data) < 8 {
+        r.err = fmt.Errorf("short read")
+        return 0
+    }
+    value := binary.BigEndian.Uint64(r.data)
+    r.data = r.data[8:]
+    return value
+}
\ No newline at end of file
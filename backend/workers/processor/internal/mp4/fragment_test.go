@@ -0,0 +1,184 @@
+package mp4
+
+import (
+    "testing"
+)
+
+func TestReadTracks(t *testing.T) {
+    video := box("trak",
+        full("tkhd", 0, 3, u32(0), u32(0), u32(1), u32(0), u32(0)),
+        box("mdia",
+            full("mdhd", 0, 0, u32(0), u32(0), u32(90000), u32(0)),
+            full("hdlr", 0, 0, u32(0), []byte("vide"))))
+    // Version 1 widens the times before track_ID and timescale to 64 bits.
+    audio := box("trak",
+        full("tkhd", 1, 3, u64(0), u64(0), u32(2), u32(0), u64(0)),
+        box("mdia",
+            full("mdhd", 1, 0, u64(0), u64(0), u32(48000), u64(0)),
+            full("hdlr", 0, 0, u32(0), []byte("soun"))))
+    mvex := box("mvex",
+        full("trex", 0, 0, u32(1), u32(1), u32(3000), u32(0), u32(0x00010000)),
+        full("trex", 0, 0, u32(2), u32(1), u32(1024), u32(6), u32(0)))
+    init := append(box("ftyp", []byte("iso6")), box("moov", video, audio, mvex)...)
+
+    tracks, err := ReadTracks(init)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []Track{
+        {ID: 1, Handler: "vide", Timescale: 90000, DefaultDuration: 3000, DefaultFlags: 0x00010000},
+        {ID: 2, Handler: "soun", Timescale: 48000, DefaultDuration: 1024, DefaultSize: 6},
+    }
+    if len(tracks) != len(want) {
+        t.Fatalf("ReadTracks = %+v, want %+v", tracks, want)
+    }
+    for i := range want {
+        if tracks[i] != want[i] {
+            t.Errorf("track %d = %+v, want %+v", i, tracks[i], want[i])
+        }
+    }
+
+    if _, err := ReadTracks(box("moov", box("trak", box("mdia")))); err == nil {
+        t.Error("ReadTracks accepted a track without tkhd")
+    }
+}
+
+func TestReadSamples(t *testing.T) {
+    track := Track{ID: 1, Timescale: 90000, DefaultDuration: 3000, DefaultSize: 10, DefaultFlags: 0x00010000}
+    // Every fragment follows a 16 byte styp, so moof-relative offsets start
+    // there.
+    const moofOffset = 16
+
+    tests := []struct {
+        name string
+        traf [][]byte
+        want []Sample
+    }{
+        {
+            name: "defaults from trex",
+            traf: [][]byte{
+                full("tfhd", 0, 0, u32(1)),
+                full("tfdt", 0, 0, u32(9000)),
+                full("trun", 0, trunDataOffset, u32(2), u32(100)),
+            },
+            want: []Sample{
+                {DecodeTime: 9000, Duration: 3000, Offset: 116, Size: 10, MoofOffset: moofOffset},
+                {DecodeTime: 12000, Duration: 3000, Offset: 126, Size: 10, MoofOffset: moofOffset},
+            },
+        },
+        {
+            name: "version 1 tfdt",
+            traf: [][]byte{
+                full("tfhd", 0, 0, u32(1)),
+                full("tfdt", 1, 0, u64(1<<33)),
+                full("trun", 0, trunDataOffset, u32(1), u32(100)),
+            },
+            want: []Sample{{DecodeTime: 1 << 33, Duration: 3000, Offset: 116, Size: 10, MoofOffset: moofOffset}},
+        },
+        {
+            name: "tfhd defaults override trex",
+            traf: [][]byte{
+                full("tfhd", 0, tfhdSampleDescription|tfhdDefaultDuration|tfhdDefaultSize|tfhdDefaultFlags,
+                    u32(1), u32(1), u32(1500), u32(40), u32(0)),
+                full("trun", 0, trunDataOffset, u32(2), u32(100)),
+            },
+            want: []Sample{
+                {Duration: 1500, Offset: 116, Size: 40, Sync: true, MoofOffset: moofOffset},
+                {DecodeTime: 1500, Duration: 1500, Offset: 156, Size: 40, Sync: true, MoofOffset: moofOffset},
+            },
+        },
+        {
+            name: "tfhd base data offset",
+            traf: [][]byte{
+                full("tfhd", 0, tfhdBaseDataOffset, u32(1), u64(5000)),
+                full("trun", 0, trunDataOffset, u32(1), u32(8)),
+            },
+            want: []Sample{{Duration: 3000, Offset: 5008, Size: 10, MoofOffset: moofOffset}},
+        },
+        {
+            name: "negative data offset",
+            traf: [][]byte{
+                full("tfhd", 0, tfhdBaseDataOffset, u32(1), u64(5000)),
+                full("trun", 0, trunDataOffset, u32(1), u32(0xffffff38)),
+            },
+            want: []Sample{{Duration: 3000, Offset: 4800, Size: 10, MoofOffset: moofOffset}},
+        },
+        {
+            name: "first sample flags mark only the first sample",
+            traf: [][]byte{
+                full("tfhd", 0, 0, u32(1)),
+                full("trun", 0, trunDataOffset|trunFirstSampleFlags|trunSampleSize,
+                    u32(3), u32(100), u32(0x02000000), u32(500), u32(20), u32(30)),
+            },
+            want: []Sample{
+                {Duration: 3000, Offset: 116, Size: 500, Sync: true, MoofOffset: moofOffset},
+                {DecodeTime: 3000, Duration: 3000, Offset: 616, Size: 20, MoofOffset: moofOffset},
+                {DecodeTime: 6000, Duration: 3000, Offset: 636, Size: 30, MoofOffset: moofOffset},
+            },
+        },
+        {
+            name: "per-sample fields",
+            traf: [][]byte{
+                full("tfhd", 0, 0, u32(1)),
+                full("trun", 0, trunDataOffset|trunSampleDuration|trunSampleSize|trunSampleFlags|trunCompositionTime,
+                    u32(2), u32(100),
+                    u32(2000), u32(50), u32(0), u32(6000),
+                    u32(4000), u32(60), u32(0x00010000), u32(0)),
+            },
+            want: []Sample{
+                {Duration: 2000, Offset: 116, Size: 50, Sync: true, MoofOffset: moofOffset},
+                {DecodeTime: 2000, Duration: 4000, Offset: 166, Size: 60, MoofOffset: moofOffset},
+            },
+        },
+        {
+            name: "a run without an offset continues the previous one",
+            traf: [][]byte{
+                full("tfhd", 0, 0, u32(1)),
+                full("trun", 0, trunDataOffset, u32(1), u32(100)),
+                full("trun", 0, 0, u32(1)),
+            },
+            want: []Sample{
+                {Duration: 3000, Offset: 116, Size: 10, MoofOffset: moofOffset},
+                {DecodeTime: 3000, Duration: 3000, Offset: 126, Size: 10, MoofOffset: moofOffset},
+            },
+        },
+        {
+            name: "other track",
+            traf: [][]byte{
+                full("tfhd", 0, 0, u32(2)),
+                full("trun", 0, trunDataOffset, u32(1), u32(100)),
+            },
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            moof := box("moof", full("mfhd", 0, 0, u32(1)), box("traf", test.traf...))
+            segment := append(box("styp", []byte("msdh"), u32(0)), moof...)
+            segment = append(segment, box("mdat", make([]byte, 32))...)
+
+            samples, err := ReadSamples(segment, track)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if len(samples) != len(test.want) {
+                t.Fatalf("ReadSamples = %+v, want %+v", samples, test.want)
+            }
+            for i := range test.want {
+                if samples[i] != test.want[i] {
+                    t.Errorf("sample %d = %+v, want %+v", i, samples[i], test.want[i])
+                }
+            }
+        })
+    }
+}
+
+func TestReadSamplesTruncatedRun(t *testing.T) {
+    track := Track{ID: 1, DefaultDuration: 3000}
+    traf := box("traf",
+        full("tfhd", 0, 0, u32(1)),
+        full("trun", 0, trunSampleSize, u32(3), u32(10), u32(20)))
+    if _, err := ReadSamples(box("moof", traf), track); err == nil {
+        t.Error("ReadSamples accepted a trun with fewer samples than its count")
+    }
+}
\ No newline at end of file
@@ -17,6 +17,68 @@ type StageProgressUpdate struct {
     Error     string
 }
 
+type LoudnessValues struct {
+    Integrated    float64
+    TruePeak      float64
+    LoudnessRange float64
+    Threshold     float64
+}
+
+type LoudnessTarget struct {
+    Integrated    float64
+    LoudnessRange float64
+    TruePeak      float64
+}
+
+type LoudnessRecord struct {
+    Track             string
+    Target            LoudnessTarget
+    Input             LoudnessValues
+    Output            LoudnessValues
+    NormalizationType string
+}
+
+type KeyRecord struct {
+    KeyID      string
+    Method     string
+    IV         string
+    WrappedKey string
+}
+
+type CropRecord struct {
+    Width  int
+    Height int
+    X      int
+    Y      int
+    Source string
+}
+
+type CadenceRecord struct {
+    Interlaced   bool
+    FieldOrder   string
+    VariableRate bool
+    SourceRate   float64
+    OutputRate   float64
+    Deinterlacer string
+}
+
+type QualityRecord struct {
+    BlackPercent   float64
+    FreezePercent  float64
+    SilencePercent float64
+    Verdict        string
+    Reasons        []string
+}
+
+type FingerprintRecord struct {
+    Duration    float64
+    DHashes     []string
+    PHashes     []string
+    Audio       string
+    DuplicateOf string
+    Distance    float64
+}
+
 type ProgressUpdater struct {
     client    *dynamodb.Client
     tableName string
@@ -26,9 +88,12 @@ type ProgressUpdater struct {
 const TimeFormat = "2006-01-02T15:04:05.000Z"
 
 const (
+    StateDispatch              = "dispatch"
     StateDownload              = "download"
     StateWriteToStorage          = "writeToStorage"
     StateInitializeProcessor   = "initializeProcessor"
+    StateQualityGate           = "qualityGate"
+    StateFingerprint           = "fingerprint"
     StateGenerateThumbnail     = "generateThumbnail"
     StateGenerateMP4Files      = "generateMP4Files"
     StateGenerateHLSPlaylists  = "generateHLSPlaylists"
@@ -38,6 +103,16 @@ const (
     StateTotalFiles = "totalFiles"
 )
 
+const (
+    MetadataLoudness      = "loudness"
+    MetadataCaptionErrors = "captionErrors"
+    MetadataEncryption    = "encryption"
+    MetadataCrop          = "crop"
+    MetadataFrameCadence  = "frameCadence"
+    MetadataQualityGate   = "qualityGate"
+    MetadataFingerprint   = "fingerprint"
+)
+
 func NewProgressUpdater(region, tableName string, userId string, assetId string) (*ProgressUpdater, error) {
     cfg, err := config.LoadDefaultConfig(context.TODO(),
         config.WithRegion(region),
@@ -98,6 +173,42 @@ func (p *ProgressUpdater) UpdateProgress(ctx context.Context, currentStage strin
     return nil
 }
 
+// RejectTask records a task that no handler accepts. The dispatch stage is
+// written whole, as records created before it existed have no map for it.
+func (p *ProgressUpdater) RejectTask(ctx context.Context, taskType, worker, reason string) error {
+    now := time.Now().UTC().Format(TimeFormat)
+
+    input := &dynamodb.UpdateItemInput{
+        TableName: &p.tableName,
+        Key: map[string]types.AttributeValue{
+            "userId":  &types.AttributeValueMemberS{Value: p.userId},
+            "assetId": &types.AttributeValueMemberS{Value: p.assetId},
+        },
+        UpdateExpression: aws.String("SET progress.#dispatch = :dispatch, stage = :stage, updatedAt = :time"),
+        ExpressionAttributeNames: map[string]string{
+            "#dispatch": StateDispatch,
+        },
+        ExpressionAttributeValues: map[string]types.AttributeValue{
+            ":dispatch": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+                "status":  &types.AttributeValueMemberS{Value: "FAILED"},
+                "endTime": &types.AttributeValueMemberS{Value: now},
+                "type":    &types.AttributeValueMemberS{Value: taskType},
+                "worker":  &types.AttributeValueMemberS{Value: worker},
+                "error":   &types.AttributeValueMemberS{Value: reason},
+            }},
+            ":stage": &types.AttributeValueMemberS{Value: StateDispatch},
+            ":time":  &types.AttributeValueMemberS{Value: now},
+        },
+    }
+
+    _, err := p.client.UpdateItem(ctx, input)
+    if err != nil {
+        return fmt.Errorf("failed to record rejected task: %v", err)
+    }
+
+    return nil
+}
+
 func (p *ProgressUpdater) UpdateFileCount(ctx context.Context, count int) error {
     input := &dynamodb.UpdateItemInput{
         TableName: &p.tableName,
@@ -121,4 +232,128 @@ func (p *ProgressUpdater) UpdateFileCount(ctx context.Context, count int) error
     }
 
     return nil
+}
+
+func (p *ProgressUpdater) UpdateLoudness(ctx context.Context, records []LoudnessRecord) error {
+    tracks := make(map[string]types.AttributeValue, len(records))
+    for _, record := range records {
+        tracks[record.Track] = &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+            "target": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+                "integrated":    &types.AttributeValueMemberS{Value: fmt.Sprintf("%.2f", record.Target.Integrated)},
+                "loudnessRange": &types.AttributeValueMemberS{Value: fmt.Sprintf("%.2f", record.Target.LoudnessRange)},
+                "truePeak":      &types.AttributeValueMemberS{Value: fmt.Sprintf("%.2f", record.Target.TruePeak)},
+            }},
+            "input":             loudnessAttribute(record.Input),
+            "output":            loudnessAttribute(record.Output),
+            "normalizationType": &types.AttributeValueMemberS{Value: record.NormalizationType},
+        }}
+    }
+
+    return p.updateMetadataField(ctx, MetadataLoudness, &types.AttributeValueMemberM{Value: tracks})
+}
+
+func (p *ProgressUpdater) updateMetadataField(ctx context.Context, field string, value types.AttributeValue) error {
+    input := &dynamodb.UpdateItemInput{
+        TableName: &p.tableName,
+        Key: map[string]types.AttributeValue{
+            "userId":  &types.AttributeValueMemberS{Value: p.userId},
+            "assetId": &types.AttributeValueMemberS{Value: p.assetId},
+        },
+        UpdateExpression: aws.String("SET metadata.#field = :value, updatedAt = :time"),
+        ExpressionAttributeNames: map[string]string{
+            "#field": field,
+        },
+        ExpressionAttributeValues: map[string]types.AttributeValue{
+            ":value": value,
+            ":time":  &types.AttributeValueMemberS{Value: time.Now().UTC().Format(TimeFormat)},
+        },
+    }
+
+    _, err := p.client.UpdateItem(ctx, input)
+    if err != nil {
+        return fmt.Errorf("failed to update metadata %s: %v", field, err)
+    }
+
+    return nil
+}
+
+func loudnessAttribute(values LoudnessValues) types.AttributeValue {
+    return &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+        "integrated":    &types.AttributeValueMemberS{Value: fmt.Sprintf("%.2f", values.Integrated)},
+        "truePeak":      &types.AttributeValueMemberS{Value: fmt.Sprintf("%.2f", values.TruePeak)},
+        "loudnessRange": &types.AttributeValueMemberS{Value: fmt.Sprintf("%.2f", values.LoudnessRange)},
+        "threshold":     &types.AttributeValueMemberS{Value: fmt.Sprintf("%.2f", values.Threshold)},
+    }}
+}
+
+func (p *ProgressUpdater) UpdateCaptionErrors(ctx context.Context, captionErrors map[string]string) error {
+    values := make(map[string]types.AttributeValue, len(captionErrors))
+    for key, message := range captionErrors {
+        values[key] = &types.AttributeValueMemberS{Value: message}
+    }
+
+    return p.updateMetadataField(ctx, MetadataCaptionErrors, &types.AttributeValueMemberM{Value: values})
+}
+
+func (p *ProgressUpdater) UpdateEncryptionKey(ctx context.Context, record KeyRecord) error {
+    return p.updateMetadataField(ctx, MetadataEncryption, &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+        "keyId":      &types.AttributeValueMemberS{Value: record.KeyID},
+        "method":     &types.AttributeValueMemberS{Value: record.Method},
+        "iv":         &types.AttributeValueMemberS{Value: record.IV},
+        "wrappedKey": &types.AttributeValueMemberS{Value: record.WrappedKey},
+    }})
+}
+
+func (p *ProgressUpdater) UpdateCrop(ctx context.Context, record CropRecord) error {
+    return p.updateMetadataField(ctx, MetadataCrop, &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+        "width":  &types.AttributeValueMemberS{Value: fmt.Sprintf("%d", record.Width)},
+        "height": &types.AttributeValueMemberS{Value: fmt.Sprintf("%d", record.Height)},
+        "x":      &types.AttributeValueMemberS{Value: fmt.Sprintf("%d", record.X)},
+        "y":      &types.AttributeValueMemberS{Value: fmt.Sprintf("%d", record.Y)},
+        "source": &types.AttributeValueMemberS{Value: record.Source},
+    }})
+}
+
+func (p *ProgressUpdater) UpdateFrameCadence(ctx context.Context, record CadenceRecord) error {
+    return p.updateMetadataField(ctx, MetadataFrameCadence, &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+        "interlaced":   &types.AttributeValueMemberBOOL{Value: record.Interlaced},
+        "fieldOrder":   &types.AttributeValueMemberS{Value: record.FieldOrder},
+        "variableRate": &types.AttributeValueMemberBOOL{Value: record.VariableRate},
+        "sourceRate":   &types.AttributeValueMemberS{Value: fmt.Sprintf("%.3f", record.SourceRate)},
+        "outputRate":   &types.AttributeValueMemberS{Value: fmt.Sprintf("%.3f", record.OutputRate)},
+        "deinterlacer": &types.AttributeValueMemberS{Value: record.Deinterlacer},
+    }})
+}
+
+func (p *ProgressUpdater) UpdateQuality(ctx context.Context, record QualityRecord) error {
+    return p.updateMetadataField(ctx, MetadataQualityGate, &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+        "blackPercent":   &types.AttributeValueMemberS{Value: fmt.Sprintf("%.2f", record.BlackPercent)},
+        "freezePercent":  &types.AttributeValueMemberS{Value: fmt.Sprintf("%.2f", record.FreezePercent)},
+        "silencePercent": &types.AttributeValueMemberS{Value: fmt.Sprintf("%.2f", record.SilencePercent)},
+        "verdict":        &types.AttributeValueMemberS{Value: record.Verdict},
+        "reasons":        stringList(record.Reasons),
+    }})
+}
+
+func (p *ProgressUpdater) UpdateFingerprint(ctx context.Context, record FingerprintRecord) error {
+    value := map[string]types.AttributeValue{
+        "duration": &types.AttributeValueMemberS{Value: fmt.Sprintf("%.3f", record.Duration)},
+        "dHash":    stringList(record.DHashes),
+        "pHash":    stringList(record.PHashes),
+        "audio":    &types.AttributeValueMemberS{Value: record.Audio},
+    }
+    if record.DuplicateOf != "" {
+        value["duplicateOf"] = &types.AttributeValueMemberS{Value: record.DuplicateOf}
+        value["distance"] = &types.AttributeValueMemberS{Value: fmt.Sprintf("%.4f", record.Distance)}
+    }
+
+    return p.updateMetadataField(ctx, MetadataFingerprint, &types.AttributeValueMemberM{Value: value})
+}
+
+func stringList(values []string) types.AttributeValue {
+    list := make([]types.AttributeValue, 0, len(values))
+    for _, value := range values {
+        list = append(list, &types.AttributeValueMemberS{Value: value})
+    }
+    return &types.AttributeValueMemberL{Value: list}
 }
\ No newline at end of file
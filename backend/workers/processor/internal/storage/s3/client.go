@@ -4,10 +4,14 @@ import (
     "context"
     "fmt"
     "bytes"
+    "io"
+    "os"
     "runtime"
 
+    "github.com/aws/aws-sdk-go-v2/aws"
     "github.com/aws/aws-sdk-go-v2/config"
     "github.com/aws/aws-sdk-go-v2/service/s3"
+    "github.com/aws/aws-sdk-go-v2/service/s3/types"
     "github.com/aws/aws-sdk-go-v2/feature/s3/manager"
     "github.com/aws/smithy-go/logging"
 )
@@ -72,6 +76,18 @@ func (s *S3Client) UploadFile(key string, data []byte, contentType string) error
     return err
 }
 
+// UploadReader streams the body through the multipart uploader, so large
+// single-file renditions never have to be held in memory.
+func (s *S3Client) UploadReader(key string, body io.Reader, contentType string) error {
+    _, err := s.uploader.Upload(context.TODO(), &s3.PutObjectInput{
+        Bucket:      &s.bucketName,
+        Key:         &key,
+        Body:        body,
+        ContentType: &contentType,
+    })
+    return err
+}
+
 
 func (s *S3Client) DownloadFile(key string) ([]byte, error) {
     buffer := manager.NewWriteAtBuffer([]byte{})
@@ -87,3 +103,83 @@ func (s *S3Client) DownloadFile(key string) ([]byte, error) {
     return buffer.Bytes(), nil
 }
 
+// DownloadToFile writes the object straight to path rather than buffering it.
+func (s *S3Client) DownloadToFile(key, path string) error {
+    file, err := os.Create(path)
+    if err != nil {
+        return fmt.Errorf("failed to create %s: %v", path, err)
+    }
+
+    _, err = s.downloader.Download(context.TODO(), file, &s3.GetObjectInput{
+        Bucket: &s.bucketName,
+        Key:    &key,
+    })
+    if closeErr := file.Close(); err == nil {
+        err = closeErr
+    }
+    if err != nil {
+        os.Remove(path)
+        return fmt.Errorf("failed to download file: %v", err)
+    }
+    return nil
+}
+
+func (s *S3Client) ListKeys(prefix string) ([]string, error) {
+    var keys []string
+    paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+        Bucket: &s.bucketName,
+        Prefix: &prefix,
+    })
+    for paginator.HasMorePages() {
+        page, err := paginator.NextPage(context.TODO())
+        if err != nil {
+            return nil, fmt.Errorf("failed to list %s: %v", prefix, err)
+        }
+        for _, object := range page.Contents {
+            keys = append(keys, *object.Key)
+        }
+    }
+    return keys, nil
+}
+
+func (s *S3Client) CopyFile(sourceKey, destinationKey string) error {
+    source := s.bucketName + "/" + sourceKey
+    _, err := s.client.CopyObject(context.TODO(), &s3.CopyObjectInput{
+        Bucket:     &s.bucketName,
+        CopySource: &source,
+        Key:        &destinationKey,
+    })
+    if err != nil {
+        return fmt.Errorf("failed to copy %s to %s: %v", sourceKey, destinationKey, err)
+    }
+    return nil
+}
+
+// DeleteKeys removes objects in batches of the 1000 keys DeleteObjects
+// accepts per request.
+func (s *S3Client) DeleteKeys(keys []string) error {
+    for start := 0; start < len(keys); start += 1000 {
+        end := start + 1000
+        if end > len(keys) {
+            end = len(keys)
+        }
+
+        objects := make([]types.ObjectIdentifier, 0, end-start)
+        for _, key := range keys[start:end] {
+            key := key
+            objects = append(objects, types.ObjectIdentifier{Key: &key})
+        }
+        output, err := s.client.DeleteObjects(context.TODO(), &s3.DeleteObjectsInput{
+            Bucket: &s.bucketName,
+            Delete: &types.Delete{Objects: objects},
+        })
+        if err != nil {
+            return fmt.Errorf("failed to delete objects: %v", err)
+        }
+        if len(output.Errors) > 0 {
+            failed := output.Errors[0]
+            return fmt.Errorf("failed to delete %d objects, first %s: %s", len(output.Errors), aws.ToString(failed.Key), aws.ToString(failed.Message))
+        }
+    }
+    return nil
+}
\ No newline at end of file
@@ -6,6 +6,7 @@ import (
     "path/filepath"
     "runtime"
     "sync"
+    "time"
 
 )
 
@@ -26,6 +27,21 @@ type UploadManager struct {
     contentBucket string
     maxWorkers    int
     bufferSize    int
+
+    mu        sync.Mutex
+    published map[string]publishedFile
+}
+
+type publishedFile struct {
+    size    int64
+    modTime time.Time
+}
+
+// Publisher uploads single files under workDir ahead of UploadAllParallel,
+// which then only sends what changed since.
+type Publisher struct {
+    manager *UploadManager
+    workDir string
 }
 
 type uploadTask struct {
@@ -48,7 +64,48 @@ func NewUploadManager(client *S3Client, userID, assetID, contentBucket string, c
         contentBucket: contentBucket,
         maxWorkers:    config.MaxWorkers,
         bufferSize:    config.BufferSize,
+        published:     make(map[string]publishedFile),
+    }
+}
+
+func (u *UploadManager) Publisher(workDir string) *Publisher {
+    return &Publisher{manager: u, workDir: workDir}
+}
+
+func (p *Publisher) Publish(path string) error {
+    u := p.manager
+    relPath, err := filepath.Rel(p.workDir, path)
+    if err != nil {
+        return fmt.Errorf("failed to get relative path for %s: %v", path, err)
     }
+
+    f, err := os.Open(path)
+    if err != nil {
+        return fmt.Errorf("failed to read file %s: %v", path, err)
+    }
+    defer f.Close()
+    info, err := f.Stat()
+    if err != nil {
+        return fmt.Errorf("failed to stat file %s: %v", path, err)
+    }
+
+    s3Key := filepath.Join(u.userID, u.assetID, relPath)
+    if err := u.client.UploadReader(s3Key, f, u.getContentType(path)); err != nil {
+        return fmt.Errorf("failed to upload %s to %s: %v", path, s3Key, err)
+    }
+
+    u.mu.Lock()
+    u.published[s3Key] = publishedFile{size: info.Size(), modTime: info.ModTime()}
+    u.mu.Unlock()
+    return nil
+}
+
+// unchanged reports whether a file was already published as it is now.
+func (u *UploadManager) unchanged(s3Key string, info os.FileInfo) bool {
+    u.mu.Lock()
+    defer u.mu.Unlock()
+    file, ok := u.published[s3Key]
+    return ok && file.size == info.Size() && file.modTime.Equal(info.ModTime())
 }
 
 func (u *UploadManager) UploadAllParallel(workDir string) (int, error) {
@@ -78,9 +135,15 @@ func (u *UploadManager) UploadAllParallel(workDir string) (int, error) {
                     return nil
                 }
 
+                // Published files still count, as the completion check
+                // compares against every object under the asset.
+                s3Key := filepath.Join(u.userID, u.assetID, relPath)
+                if u.unchanged(s3Key, info) {
+                    return nil
+                }
                 files <- uploadTask{
                     localPath: path,
-                    s3Key:    filepath.Join(u.userID, u.assetID, relPath),
+                    s3Key:    s3Key,
                 }
             }
             return nil
@@ -112,16 +175,17 @@ func (u *UploadManager) uploadWorker(files <-chan uploadTask, errors chan<- erro
     defer wg.Done()
 
     for file := range files {
-        data, err := os.ReadFile(file.localPath)
+        f, err := os.Open(file.localPath)
         if err != nil {
             errors <- fmt.Errorf("failed to read file %s: %v", file.localPath, err)
             continue
         }
 
         contentType := u.getContentType(file.localPath)
-        if err := u.client.UploadFile(file.s3Key, data, contentType); err != nil {
+        if err := u.client.UploadReader(file.s3Key, f, contentType); err != nil {
             errors <- fmt.Errorf("failed to upload %s to %s: %v", file.localPath, file.s3Key, err)
         }
+        f.Close()
     }
 }
 
@@ -130,12 +194,16 @@ func (u *UploadManager) getContentType(filename string) string {
     switch ext {
     case ".m3u8":
         return "application/vnd.apple.mpegurl"
+    case ".mpd":
+        return "application/dash+xml"
     case ".mp4":
         return "video/mp4"
     case ".m4s":
         return "video/iso.segment"
     case ".m4a":
         return "audio/mp4"
+    case ".vtt":
+        return "text/vtt"
     case ".png":
         return "image/png"
     case ".jpg", ".jpeg":
@@ -0,0 +1,244 @@
+package transcoder
+
+import (
+    "fmt"
+    "path/filepath"
+    "strings"
+)
+
+const undeterminedLanguage = "und"
+
+const (
+    stereoAudioGroup   = "audio"
+    surroundAudioGroup = "audio-surround"
+)
+
+type audioGroup struct {
+    ID     string
+    Tracks []AudioTrack
+}
+
+func buildAudioTracks(streams []AudioStream, rules AudioRules, surround SurroundConfig, audio AudioProfile) []AudioTrack {
+    if len(streams) == 0 {
+        return nil
+    }
+
+    defaultIndex := selectDefaultAudio(streams, rules)
+    usedTitles := make(map[string]int)
+    tracks := make([]AudioTrack, 0, len(streams))
+
+    for i, stream := range streams {
+        language := normalizeLanguage(stream.Language)
+
+        title := strings.ReplaceAll(strings.TrimSpace(stream.Title), "\"", "'")
+        if title == "" {
+            title = defaultAudioTitle(language, i)
+        }
+        usedTitles[title]++
+        if count := usedTitles[title]; count > 1 {
+            title = fmt.Sprintf("%s %d", title, count)
+        }
+
+        track := AudioTrack{
+            Name:        fmt.Sprintf("%s_%d", language, stream.Index),
+            StreamIndex: stream.Index,
+            Language:    language,
+            Title:       title,
+            Codec:       audio.Codec,
+            Bitrate:     audio.Bitrate,
+            SampleRate:  audio.SampleRate,
+            Channels:    audio.Channels,
+            Default:     i == defaultIndex,
+        }
+        track.AutoSelect = track.Default || isAutoSelectAudio(stream, language, rules)
+
+        // The default stereo track keeps the original single-track locations so
+        // existing consumers of audio.m4a and audio/stream.m3u8 keep working.
+        if track.Default {
+            track.MP4File = "audio.m4a"
+            track.PlaylistDir = "audio"
+        } else {
+            track.MP4File = fmt.Sprintf("audio_%s.m4a", track.Name)
+            track.PlaylistDir = filepath.Join("audio", track.Name)
+        }
+
+        tracks = append(tracks, track)
+
+        if !surround.Disabled && stream.Channels >= 6 {
+            tracks = append(tracks, surroundTrack(track, surround))
+        }
+    }
+
+    return tracks
+}
+
+func surroundTrack(stereo AudioTrack, config SurroundConfig) AudioTrack {
+    codec := config.Codec
+    if codec == "" {
+        codec = "aac"
+    }
+    bitrate := config.Bitrate
+    if bitrate == "" {
+        bitrate = "384k"
+        if codec == "eac3" {
+            bitrate = "448k"
+        }
+    }
+
+    track := stereo
+    track.Name = stereo.Name + "_51"
+    track.Title = stereo.Title + " 5.1"
+    track.Codec = codec
+    track.Bitrate = bitrate
+    track.SampleRate = 48000
+    track.Channels = 6
+    track.MP4File = fmt.Sprintf("audio_%s.m4a", track.Name)
+    track.PlaylistDir = filepath.Join("audio", track.Name)
+    return track
+}
+
+// Players pick a whole group per variant, so the surround group carries the
+// 5.1 rendition where one exists and falls back to stereo for the rest.
+func (p *Processor) audioGroups() []audioGroup {
+    if len(p.AudioTracks) == 0 {
+        return nil
+    }
+
+    stereo := audioGroup{ID: stereoAudioGroup}
+    surroundByStream := make(map[int]AudioTrack)
+    for _, track := range p.AudioTracks {
+        if track.isSurround() {
+            surroundByStream[track.StreamIndex] = track
+        } else {
+            stereo.Tracks = append(stereo.Tracks, track)
+        }
+    }
+
+    if len(surroundByStream) == 0 {
+        return []audioGroup{stereo}
+    }
+
+    surround := audioGroup{ID: surroundAudioGroup}
+    for _, track := range stereo.Tracks {
+        if surroundTrack, ok := surroundByStream[track.StreamIndex]; ok {
+            surround.Tracks = append(surround.Tracks, surroundTrack)
+        } else {
+            surround.Tracks = append(surround.Tracks, track)
+        }
+    }
+
+    return []audioGroup{stereo, surround}
+}
+
+func (g audioGroup) codecs() []string {
+    seen := make(map[string]bool)
+    var codecs []string
+    for _, track := range g.Tracks {
+        tag := audioCodecTag(track.Codec)
+        if !seen[tag] {
+            seen[tag] = true
+            codecs = append(codecs, tag)
+        }
+    }
+    return codecs
+}
+
+func (g audioGroup) bandwidth() int {
+    max := 0
+    for _, track := range g.Tracks {
+        if bandwidth := getBandwidth(track.Bitrate); bandwidth > max {
+            max = bandwidth
+        }
+    }
+    return max
+}
+
+func (t AudioTrack) isSurround() bool {
+    return t.Channels > 2
+}
+
+func audioCodecTag(codec string) string {
+    switch codec {
+    case "eac3":
+        return "ec-3"
+    case "ac3":
+        return "ac-3"
+    default:
+        return "mp4a.40.2"
+    }
+}
+
+func selectDefaultAudio(streams []AudioStream, rules AudioRules) int {
+    for _, preferred := range rules.DefaultLanguages {
+        for i, stream := range streams {
+            if stream.IsCommentary {
+                continue
+            }
+            if strings.EqualFold(normalizeLanguage(stream.Language), preferred) {
+                return i
+            }
+        }
+    }
+
+    for i, stream := range streams {
+        if stream.IsDefault {
+            return i
+        }
+    }
+
+    return 0
+}
+
+func isAutoSelectAudio(stream AudioStream, language string, rules AudioRules) bool {
+    if stream.IsCommentary {
+        return false
+    }
+    if len(rules.AutoSelectLanguages) == 0 {
+        return true
+    }
+    for _, candidate := range rules.AutoSelectLanguages {
+        if strings.EqualFold(language, candidate) {
+            return true
+        }
+    }
+    return false
+}
+
+func normalizeLanguage(language string) string {
+    language = strings.Map(func(r rune) rune {
+        if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
+            return r
+        }
+        return -1
+    }, strings.ToLower(language))
+    if language == "" {
+        return undeterminedLanguage
+    }
+    return language
+}
+
+func defaultAudioTitle(language string, position int) string {
+    if language != undeterminedLanguage {
+        return language
+    }
+    if position == 0 {
+        return "Original"
+    }
+    return fmt.Sprintf("Track %d", position+1)
+}
+
+func (p *Processor) defaultAudioTrack() AudioTrack {
+    for _, track := range p.AudioTracks {
+        if track.Default && !track.isSurround() {
+            return track
+        }
+    }
+    return p.AudioTracks[0]
+}
+
+func yesNo(value bool) string {
+    if value {
+        return "YES"
+    }
+    return "NO"
+}
\ No newline at end of file
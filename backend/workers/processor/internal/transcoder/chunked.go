@@ -0,0 +1,388 @@
+package transcoder
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "math"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+const (
+    DefaultChunkMinDuration = 120.0
+
+    // Chunks shorter than this cost more in encoder start-up than they save.
+    minChunkDuration = 10.0
+)
+
+// ChunkUnit is one chunk of one rendition. Passes holds the complete ffmpeg
+// command of each encoding pass, run in order. Input, Output and the paths in
+// Passes are local to this worker, so a queue that encodes elsewhere has to
+// move the files and rewrite the paths itself.
+type ChunkUnit struct {
+    Name    string     `json:"name"`
+    Chunk   int        `json:"chunk"`
+    Input   string     `json:"input"`
+    Output  string     `json:"output"`
+    Threads int        `json:"threads"`
+    Passes  [][]string `json:"passes"`
+}
+
+// ChunkQueue encodes chunk units. When Encode returns nil every unit's
+// Output must exist locally.
+type ChunkQueue interface {
+    Encode(ctx context.Context, units []ChunkUnit) error
+}
+
+// LocalChunkQueue encodes units in this process under a thread budget.
+type LocalChunkQueue struct {
+    Budget int
+}
+
+func (q *LocalChunkQueue) Encode(ctx context.Context, units []ChunkUnit) error {
+    jobs := make([]Job, 0, len(units))
+    for _, unit := range units {
+        unit := unit
+        jobs = append(jobs, Job{
+            Name:    unit.Name,
+            Threads: unit.Threads,
+            Run: func(ctx context.Context, threads int) error {
+                // The rendition cannot be stitched without every chunk.
+                for _, args := range unit.Passes {
+                    if err := runFFmpegContext(ctx, args); err != nil {
+                        return Fatal(err)
+                    }
+                }
+                return nil
+            },
+        })
+    }
+    return NewScheduler(q.Budget).Run(ctx, jobs)
+}
+
+type sourceChunk struct {
+    Path     string
+    Start    float64
+    Duration float64
+}
+
+func (p *Processor) chunkCount() int {
+    c := p.Config.Chunking
+    if c == nil || c.Count < 2 {
+        return 0
+    }
+    minDuration := c.MinDuration
+    if minDuration == 0 {
+        minDuration = DefaultChunkMinDuration
+    }
+    if p.VideoInfo.Duration < minDuration {
+        return 0
+    }
+
+    // Forced scene keyframes and timed watermarks are expressed on the
+    // source timeline, which a chunk does not see.
+    if p.alignSegments() {
+        log.Printf("Chunked encoding skipped: segments are aligned to scenes")
+        return 0
+    }
+    if w := p.Config.Watermark; w != nil && (w.Start > 0 || w.End > 0) {
+        log.Printf("Chunked encoding skipped: watermark is timed")
+        return 0
+    }
+
+    count := c.Count
+    if limit := int(p.VideoInfo.Duration / minChunkDuration); count > limit {
+        count = limit
+    }
+    if count < 2 {
+        return 0
+    }
+    return count
+}
+
+func (p *Processor) chunkQueue() ChunkQueue {
+    if p.Config.Chunking.Queue != nil {
+        return p.Config.Chunking.Queue
+    }
+    return &LocalChunkQueue{Budget: p.threadBudget()}
+}
+
+// generateChunkedMP4 splits the source at keyframes, encodes every
+// chunk/rendition pair as its own unit, and stitches each rendition back into
+// one MP4 with continuous timestamps. A rendition whose seams do not hold,
+// such as after a cut inside an open GOP dropped frames, is encoded whole.
+func (p *Processor) generateChunkedMP4(ctx context.Context, count, threads int) error {
+    chunkDir := filepath.Join(filepath.Dir(p.Paths.BaseDir), "chunks")
+    defer os.RemoveAll(chunkDir)
+    if err := os.MkdirAll(chunkDir, 0755); err != nil {
+        return fmt.Errorf("failed to create chunk directory: %v", err)
+    }
+
+    chunks, err := p.splitSource(chunkDir, count)
+    if err != nil {
+        return err
+    }
+    log.Printf("Encoding %d chunks of %d renditions", len(chunks), len(p.Resolutions))
+
+    perChunk := p.threadBudget() / len(chunks)
+    if perChunk < 1 {
+        perChunk = 1
+    }
+    shares := threadShares(p.Resolutions, perChunk)
+
+    var units []ChunkUnit
+    for r, res := range p.Resolutions {
+        if err := os.MkdirAll(filepath.Join(chunkDir, res.Name), 0755); err != nil {
+            return err
+        }
+        for i, chunk := range chunks {
+            units = append(units, p.chunkUnit(res, i, chunk, chunkDir, shares[r]))
+        }
+    }
+
+    if err := p.chunkQueue().Encode(ctx, units); err != nil {
+        return fmt.Errorf("chunk encoding failed: %w", err)
+    }
+
+    for _, res := range p.Resolutions {
+        if err := p.stitchChunks(ctx, res, chunks, chunkDir); err != nil {
+            return err
+        }
+        if err := p.verifySeams(res); err != nil {
+            log.Printf("Chunked %s failed the seam check, encoding it whole: %v", res.Name, err)
+            if err := p.generateMP4(ctx, p.InputPath, res, threads); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+// splitSource cuts the video stream into chunks by stream copy. Cut points are
+// the keyframes nearest to an even split, so every chunk starts decodable.
+func (p *Processor) splitSource(chunkDir string, count int) ([]sourceChunk, error) {
+    output, err := runFFprobe([]string{
+        "-v", "error",
+        "-select_streams", "v:0",
+        "-show_entries", "packet=pts_time,flags",
+        "-of", "csv=p=0",
+        p.InputPath,
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to list keyframes: %v", err)
+    }
+
+    var keyframes []float64
+    for _, line := range strings.Split(string(output), "\n") {
+        fields := strings.Split(strings.TrimSpace(line), ",")
+        if len(fields) < 2 || !strings.HasPrefix(fields[1], "K") {
+            continue
+        }
+        if t, err := strconv.ParseFloat(fields[0], 64); err == nil {
+            keyframes = append(keyframes, t)
+        }
+    }
+    sort.Float64s(keyframes)
+    if len(keyframes) == 0 {
+        return nil, fmt.Errorf("no keyframes found")
+    }
+
+    origin := keyframes[0]
+    target := p.VideoInfo.Duration / float64(count)
+    var cuts []string
+    last := 0.0
+    for i := 1; i < count; i++ {
+        best := -1.0
+        for _, keyframe := range keyframes {
+            t := keyframe - origin
+            if t-last < minChunkDuration || p.VideoInfo.Duration-t < minChunkDuration {
+                continue
+            }
+            if best < 0 || math.Abs(t-float64(i)*target) < math.Abs(best-float64(i)*target) {
+                best = t
+            }
+        }
+        if best < 0 {
+            break
+        }
+        // The segment muxer cuts at the first keyframe at or after a time, so
+        // the cut is nudged below the keyframe to survive rounding.
+        cuts = append(cuts, fmt.Sprintf("%.3f", math.Max(0, best-0.001)))
+        last = best
+    }
+
+    args := []string{
+        "-v", "error",
+        "-i", p.InputPath,
+        "-map", "0:v:0",
+        "-c", "copy",
+        "-f", "segment",
+        "-reset_timestamps", "1",
+    }
+    if len(cuts) > 0 {
+        args = append(args, "-segment_times", strings.Join(cuts, ","))
+    }
+    args = append(args, filepath.Join(chunkDir, "source_%03d.mkv"))
+    if err := runFFmpeg(args); err != nil {
+        return nil, fmt.Errorf("failed to split source: %v", err)
+    }
+
+    paths, err := filepath.Glob(filepath.Join(chunkDir, "source_*.mkv"))
+    if err != nil {
+        return nil, err
+    }
+    sort.Strings(paths)
+
+    // Offsets come from the chunks as written rather than the planned cuts,
+    // in case the muxer picked a later keyframe.
+    var chunks []sourceChunk
+    start := 0.0
+    for _, path := range paths {
+        info, err := getVideoInfo(path)
+        if err != nil {
+            return nil, fmt.Errorf("failed to probe chunk %s: %v", filepath.Base(path), err)
+        }
+        chunks = append(chunks, sourceChunk{Path: path, Start: start, Duration: info.Duration})
+        start += info.Duration
+    }
+    return chunks, nil
+}
+
+func (p *Processor) chunkUnit(res Resolution, index int, chunk sourceChunk, chunkDir string, threads int) ChunkUnit {
+    output := filepath.Join(chunkDir, res.Name, fmt.Sprintf("chunk_%03d.mp4", index))
+    scaleFilter := p.cadenceFilter() + p.cropFilter() + p.ladderScale(res)
+
+    args := []string{
+        "-v", "error",
+        "-i", chunk.Path,
+    }
+    if p.Config.Watermark != nil {
+        args = append(args,
+            "-i", p.Config.Watermark.ImagePath,
+            "-filter_complex", p.watermarkFilter(scaleFilter, res),
+            "-map", "[v]")
+    } else {
+        args = append(args, "-vf", scaleFilter+",format=yuv420p")
+    }
+    // Chunk pass logs are scratch data and go with the chunks.
+    var passes [][]string
+    passLog := filepath.Join(chunkDir, res.Name, fmt.Sprintf("chunk_%03d_passlog", index))
+    for _, pass := range encodePasses(res, passLog) {
+        passes = append(passes, append(args[:len(args):len(args)], p.encodeArgs(res, p.chunkKeyframeArgs(chunk), output, threads, pass)...))
+    }
+
+    return ChunkUnit{
+        Name:    fmt.Sprintf("%s chunk %d", res.Name, index),
+        Chunk:   index,
+        Input:   chunk.Path,
+        Output:  output,
+        Threads: threads,
+        Passes:  passes,
+    }
+}
+
+// chunkKeyframeArgs keeps keyframes on the source-wide GOP grid, so
+// the stitched rendition segments exactly as a single encode would. Each chunk
+// additionally opens with a keyframe of its own.
+func (p *Processor) chunkKeyframeArgs(chunk sourceChunk) []string {
+    gop := p.profile().Video.GOP
+    times := []string{"0"}
+    for t := math.Ceil(chunk.Start/gop) * gop; t < chunk.Start+chunk.Duration; t += gop {
+        if offset := t - chunk.Start; offset > 0.001 {
+            times = append(times, fmt.Sprintf("%.3f", offset))
+        }
+    }
+    return []string{
+        "-force_key_frames", strings.Join(times, ","),
+        "-g", fmt.Sprintf("%d", p.keyframeInterval()*3/2),
+    }
+}
+
+// stitchChunks joins a rendition's chunks with the concat demuxer, which
+// offsets each chunk by the duration of those before it.
+func (p *Processor) stitchChunks(ctx context.Context, res Resolution, chunks []sourceChunk, chunkDir string) error {
+    var list []string
+    for i := range chunks {
+        path := filepath.Join(chunkDir, res.Name, fmt.Sprintf("chunk_%03d.mp4", i))
+        list = append(list, fmt.Sprintf("file '%s'", strings.ReplaceAll(path, "'", `'\''`)))
+    }
+    listFile := filepath.Join(chunkDir, res.Name, "chunks.txt")
+    if err := os.WriteFile(listFile, []byte(strings.Join(list, "\n")+"\n"), 0644); err != nil {
+        return err
+    }
+
+    args := []string{
+        "-v", "error",
+        "-f", "concat",
+        "-safe", "0",
+        "-i", listFile,
+        "-map", "0:v:0",
+        "-c", "copy",
+        "-movflags", "+faststart",
+        "-metadata", "encoded_by=ShortRelay",
+        "-y",
+        filepath.Join(p.Paths.MP4Dir, fmt.Sprintf("%s.mp4", res.Name)),
+    }
+    if err := runFFmpegContext(ctx, args); err != nil {
+        return fmt.Errorf("failed to stitch %s: %v", res.Name, err)
+    }
+    return nil
+}
+
+// verifySeams checks the stitched rendition for gaps or overlaps between
+// frames, which would surface as stalls or skipped frames in the segments
+// cut across a chunk boundary, and for drift against the source duration.
+func (p *Processor) verifySeams(res Resolution) error {
+    output, err := runFFprobe([]string{
+        "-v", "error",
+        "-select_streams", "v:0",
+        "-show_entries", "packet=pts_time",
+        "-of", "csv=p=0",
+        filepath.Join(p.Paths.MP4Dir, fmt.Sprintf("%s.mp4", res.Name)),
+    })
+    if err != nil {
+        return fmt.Errorf("failed to probe %s: %v", res.Name, err)
+    }
+
+    var times []float64
+    for _, line := range strings.Split(string(output), "\n") {
+        if t, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(line, ",")), 64); err == nil {
+            times = append(times, t)
+        }
+    }
+    if err := checkSeams(times, p.outputFrameRate(), p.VideoInfo.Duration); err != nil {
+        return fmt.Errorf("stitched %s: %v", res.Name, err)
+    }
+    return nil
+}
+
+// checkSeams expects one frame every 1/rate seconds across the whole source
+// duration. Chunks are cut from the source itself, so the source rather than
+// the chunks is the reference: frames a cut dropped show up as missing time.
+func checkSeams(times []float64, rate, duration float64) error {
+    if len(times) < 2 {
+        return fmt.Errorf("no frames")
+    }
+    times = append([]float64(nil), times...)
+    sort.Float64s(times)
+
+    frame := 1 / rate
+    for i := 1; i < len(times); i++ {
+        gap := times[i] - times[i-1]
+        if gap <= frame/2 || gap > frame*1.5 {
+            return fmt.Errorf("seam at %.3fs: frames %.3fs apart", times[i-1], gap)
+        }
+    }
+
+    // The container duration can run slightly past the last frame, but not
+    // by the frames a bad cut loses.
+    actual := times[len(times)-1] - times[0] + frame
+    if math.Abs(actual-duration) > frame*1.5 {
+        return fmt.Errorf("lasts %.3fs, expected %.3fs", actual, duration)
+    }
+    return nil
+}
\ No newline at end of file
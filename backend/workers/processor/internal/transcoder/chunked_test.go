@@ -0,0 +1,79 @@
+package transcoder
+
+import (
+    "strings"
+    "testing"
+)
+
+// frameTimes returns a timeline of count frames at rate, starting at start.
+func frameTimes(start, rate float64, count int) []float64 {
+    times := make([]float64, count)
+    for i := range times {
+        times[i] = start + float64(i)/rate
+    }
+    return times
+}
+
+func TestCheckSeams(t *testing.T) {
+    whole := frameTimes(0, 25, 250)
+    gap := append(frameTimes(0, 25, 100), frameTimes(4.2, 25, 145)...)
+    overlap := append(frameTimes(0, 25, 100), frameTimes(3.97, 25, 150)...)
+
+    tests := []struct {
+        name     string
+        times    []float64
+        duration float64
+        problem  string
+    }{
+        {name: "continuous", times: whole, duration: 10},
+        {name: "out of order packets", times: append(append([]float64(nil), whole[1:]...), whole[0]), duration: 10},
+        {name: "gap at seam", times: gap, duration: 10, problem: "seam at 3.960s"},
+        {name: "overlap at seam", times: overlap, duration: 10, problem: "seam at 3.960s"},
+        // An open-GOP cut that lost frames leaves no gap once the concat
+        // demuxer closes it up, only a shorter rendition.
+        {name: "frames lost at a cut", times: frameTimes(0, 25, 247), duration: 10, problem: "lasts 9.880s"},
+        {name: "container runs past the last frame", times: whole, duration: 10.04},
+        {name: "no frames", times: whole[:1], duration: 10, problem: "no frames"},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            err := checkSeams(test.times, 25, test.duration)
+            if test.problem == "" {
+                if err != nil {
+                    t.Errorf("checkSeams = %v, want nil", err)
+                }
+                return
+            }
+            if err == nil || !strings.Contains(err.Error(), test.problem) {
+                t.Errorf("checkSeams = %v, want %q", err, test.problem)
+            }
+        })
+    }
+}
+
+func TestChunkKeyframeArgs(t *testing.T) {
+    profile := DefaultProfile()
+    p := &Processor{Config: &ProcessorConfig{Profile: &profile}, Cadence: FrameCadence{OutputRate: 25}}
+
+    tests := []struct {
+        name  string
+        chunk sourceChunk
+        times string
+    }{
+        {name: "first chunk", chunk: sourceChunk{Start: 0, Duration: 5}, times: "0,2.000,4.000"},
+        {name: "starts between keyframes", chunk: sourceChunk{Start: 3, Duration: 5}, times: "0,1.000,3.000"},
+        {name: "starts on a keyframe", chunk: sourceChunk{Start: 4, Duration: 4.5}, times: "0,2.000,4.000"},
+        {name: "rounding below the grid", chunk: sourceChunk{Start: 5.9995, Duration: 3}, times: "0,2.000"},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            args := p.chunkKeyframeArgs(test.chunk)
+            want := []string{"-force_key_frames", test.times, "-g", "75"}
+            if strings.Join(args, " ") != strings.Join(want, " ") {
+                t.Errorf("chunkKeyframeArgs = %v, want %v", args, want)
+            }
+        })
+    }
+}
\ No newline at end of file
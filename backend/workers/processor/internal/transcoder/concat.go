@@ -0,0 +1,173 @@
+package transcoder
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+const (
+    TransitionNone      = "none"
+    TransitionCrossfade = "crossfade"
+
+    concatFrameRate  = 30
+    concatSampleRate = 48000
+)
+
+type Transition struct {
+    Type     string
+    Duration float64
+}
+
+// Concatenate normalizes every clip to the first clip's frame size, a
+// constant frame rate, square pixels and stereo audio, then joins them into
+// a single intermediate that the usual pipeline can process as one input.
+func Concatenate(inputs []string, outputPath string, transition *Transition) error {
+    if len(inputs) == 0 {
+        return fmt.Errorf("no inputs to concatenate")
+    }
+
+    clips := make([]*VideoInfo, 0, len(inputs))
+    durations := make([]float64, 0, len(inputs))
+    for i, input := range inputs {
+        info, err := getVideoInfo(input)
+        if err != nil {
+            return fmt.Errorf("clip %d: %v", i+1, err)
+        }
+        duration := videoDuration(input, info.Duration)
+        if duration <= 0 {
+            return fmt.Errorf("clip %d: unknown duration", i+1)
+        }
+        clips = append(clips, info)
+        durations = append(durations, duration)
+    }
+
+    crossfade := 0.0
+    if transition != nil {
+        switch transition.Type {
+        case "", TransitionNone:
+        case TransitionCrossfade:
+            crossfade = transition.Duration
+            if crossfade <= 0 {
+                crossfade = 0.5
+            }
+        default:
+            return fmt.Errorf("unknown transition: %s", transition.Type)
+        }
+    }
+    for i, duration := range durations {
+        if crossfade > 0 && duration <= crossfade {
+            return fmt.Errorf("clip %d is shorter than the %.2fs transition", i+1, crossfade)
+        }
+    }
+
+    width := clips[0].Width / 2 * 2
+    height := clips[0].Height / 2 * 2
+
+    args := []string{"-v", "error"}
+    for _, input := range inputs {
+        args = append(args, "-i", input)
+    }
+
+    // Clips without audio get a silent source so every segment has both
+    // streams; lavfi inputs are numbered after the clips. Audio is padded or
+    // cut to the video's length, so a clip whose audio ends early or runs
+    // long does not shift the clips after it out of sync.
+    var filters []string
+    silentInput := len(inputs)
+    for i, clip := range clips {
+        filters = append(filters, fmt.Sprintf(
+            "[%d:v:0]scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,"+
+                "setsar=1,fps=%d,format=yuv420p,settb=AVTB,setpts=PTS-STARTPTS[v%d]",
+            i, width, height, width, height, concatFrameRate, i))
+
+        audioInput := fmt.Sprintf("%d:a:0", i)
+        if !clip.HasAudio {
+            args = append(args,
+                "-f", "lavfi",
+                "-t", fmt.Sprintf("%.3f", durations[i]),
+                "-i", fmt.Sprintf("anullsrc=r=%d:cl=stereo", concatSampleRate))
+            audioInput = fmt.Sprintf("%d:a:0", silentInput)
+            silentInput++
+        }
+        filters = append(filters, fmt.Sprintf(
+            "[%s]aformat=sample_rates=%d:channel_layouts=stereo,aresample=async=1,asetpts=PTS-STARTPTS,"+
+                "apad,atrim=duration=%.3f[a%d]",
+            audioInput, concatSampleRate, durations[i], i))
+    }
+
+    if crossfade > 0 && len(clips) > 1 {
+        filters = append(filters, crossfadeFilters(durations, crossfade)...)
+    } else {
+        var concatInputs strings.Builder
+        for i := range clips {
+            fmt.Fprintf(&concatInputs, "[v%d][a%d]", i, i)
+        }
+        filters = append(filters, fmt.Sprintf("%sconcat=n=%d:v=1:a=1[v][a]", concatInputs.String(), len(clips)))
+    }
+
+    args = append(args,
+        "-filter_complex", strings.Join(filters, ";"),
+        "-map", "[v]",
+        "-map", "[a]",
+        // Near-lossless, since the ladder encodes the intermediate again.
+        "-c:v", "libx264",
+        "-preset", "veryfast",
+        "-crf", "12",
+        "-c:a", "flac",
+        "-y",
+        outputPath,
+    )
+
+    if err := runFFmpeg(args); err != nil {
+        return fmt.Errorf("concatenation failed: %v", err)
+    }
+    return nil
+}
+
+// Each xfade starts where the running output ends minus the overlap, so the
+// offset accumulates every clip's video duration less one transition per
+// join. The audio has been cut to the same lengths, so acrossfade overlaps
+// at the same points.
+func crossfadeFilters(durations []float64, duration float64) []string {
+    var filters []string
+    videoLabel, audioLabel := "v0", "a0"
+    offset := 0.0
+
+    for i := 1; i < len(durations); i++ {
+        offset += durations[i-1] - duration
+        nextVideo, nextAudio := fmt.Sprintf("xv%d", i), fmt.Sprintf("xa%d", i)
+        if i == len(durations)-1 {
+            nextVideo, nextAudio = "v", "a"
+        }
+
+        filters = append(filters,
+            fmt.Sprintf("[%s][v%d]xfade=transition=fade:duration=%.3f:offset=%.3f[%s]",
+                videoLabel, i, duration, offset, nextVideo),
+            fmt.Sprintf("[%s][a%d]acrossfade=d=%.3f[%s]",
+                audioLabel, i, duration, nextAudio))
+        videoLabel, audioLabel = nextVideo, nextAudio
+    }
+
+    return filters
+}
+
+// videoDuration is the duration of the first video stream. Containers such as
+// Matroska only record the overall duration, which is used then.
+func videoDuration(inputPath string, fallback float64) float64 {
+    output, err := runFFprobe([]string{
+        "-v", "error",
+        "-select_streams", "v:0",
+        "-show_entries", "stream=duration",
+        "-of", "csv=p=0",
+        inputPath,
+    })
+    if err != nil {
+        return fallback
+    }
+    duration, err := strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+    if err != nil || duration <= 0 {
+        return fallback
+    }
+    return duration
+}
\ No newline at end of file
@@ -0,0 +1,42 @@
+package transcoder
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestCrossfadeFilters(t *testing.T) {
+    tests := []struct {
+        name      string
+        durations []float64
+        want      []string
+    }{
+        {
+            name:      "two clips",
+            durations: []float64{10, 8},
+            want: []string{
+                "[v0][v1]xfade=transition=fade:duration=0.500:offset=9.500[v]",
+                "[a0][a1]acrossfade=d=0.500[a]",
+            },
+        },
+        {
+            name:      "offsets accumulate",
+            durations: []float64{10, 8, 5.04},
+            want: []string{
+                "[v0][v1]xfade=transition=fade:duration=0.500:offset=9.500[xv1]",
+                "[a0][a1]acrossfade=d=0.500[xa1]",
+                "[xv1][v2]xfade=transition=fade:duration=0.500:offset=17.000[v]",
+                "[xa1][a2]acrossfade=d=0.500[a]",
+            },
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            filters := crossfadeFilters(test.durations, 0.5)
+            if strings.Join(filters, ";") != strings.Join(test.want, ";") {
+                t.Errorf("crossfadeFilters = %v, want %v", filters, test.want)
+            }
+        })
+    }
+}
\ No newline at end of file
@@ -0,0 +1,155 @@
+package transcoder
+
+import (
+    "fmt"
+    "log"
+    "regexp"
+    "strconv"
+    "strings"
+)
+
+const (
+    CropAuto = "auto"
+    CropOff  = "off"
+
+    CropSourceDetected = "detected"
+    CropSourceManual   = "manual"
+
+    cropSamples        = 8
+    cropSampleDuration = 2.0
+)
+
+var cropdetectLine = regexp.MustCompile(`crop=(\d+):(\d+):(\d+):(\d+)`)
+
+type CropRect struct {
+    Width  int
+    Height int
+    X      int
+    Y      int
+}
+
+func (c CropRect) filter() string {
+    return fmt.Sprintf("crop=%d:%d:%d:%d", c.Width, c.Height, c.X, c.Y)
+}
+
+// ParseCrop reads a manual crop in cropdetect's W:H:X:Y form.
+func ParseCrop(value string) (CropRect, error) {
+    parts := strings.Split(value, ":")
+    if len(parts) != 4 {
+        return CropRect{}, fmt.Errorf("invalid crop %q, expected width:height:x:y", value)
+    }
+
+    var values [4]int
+    for i, part := range parts {
+        parsed, err := strconv.Atoi(strings.TrimSpace(part))
+        if err != nil || parsed < 0 {
+            return CropRect{}, fmt.Errorf("invalid crop %q, expected width:height:x:y", value)
+        }
+        values[i] = parsed
+    }
+
+    crop := CropRect{Width: values[0], Height: values[1], X: values[2], Y: values[3]}
+    if crop.Width < 2 || crop.Height < 2 {
+        return CropRect{}, fmt.Errorf("invalid crop %q, area is empty", value)
+    }
+    return crop, nil
+}
+
+func (p *Processor) applyCrop() error {
+    var crop *CropRect
+    source := CropSourceManual
+
+    switch p.Config.Crop {
+    case "", CropOff:
+        return nil
+    case CropAuto:
+        crop = p.detectCrop()
+        source = CropSourceDetected
+    default:
+        manual, err := ParseCrop(p.Config.Crop)
+        if err != nil {
+            return err
+        }
+        crop = &manual
+    }
+
+    if crop == nil || (crop.Width == p.VideoInfo.Width && crop.Height == p.VideoInfo.Height) {
+        return nil
+    }
+    if crop.X+crop.Width > p.VideoInfo.Width || crop.Y+crop.Height > p.VideoInfo.Height {
+        return fmt.Errorf("crop %s falls outside the %dx%d frame", crop.filter(), p.VideoInfo.Width, p.VideoInfo.Height)
+    }
+
+    p.Crop = crop
+    p.CropSource = source
+
+    // Later stages size renditions off the visible picture, not the bars.
+    p.VideoInfo.Width = crop.Width
+    p.VideoInfo.Height = crop.Height
+    p.VideoInfo.IsVertical = crop.Height > crop.Width
+    return nil
+}
+
+// detectCrop samples short windows spread across the video and only trusts a
+// rectangle that most of them agree on, so a dark scene or a fade cannot
+// crop into the picture.
+func (p *Processor) detectCrop() *CropRect {
+    counts := make(map[CropRect]int)
+    sampled := 0
+
+    for i := 0; i < cropSamples; i++ {
+        start := p.VideoInfo.Duration * float64(i+1) / float64(cropSamples+1)
+        args := []string{
+            "-hide_banner",
+            "-nostats",
+            "-v", "info",
+            "-ss", fmt.Sprintf("%.2f", start),
+            "-t", fmt.Sprintf("%.2f", cropSampleDuration),
+            "-i", p.InputPath,
+            "-an",
+            "-vf", "cropdetect=limit=24:round=2:reset=0",
+            "-f", "null",
+            "-",
+        }
+
+        output, err := runFFmpegCapture(args)
+        if err != nil {
+            log.Printf("Crop detection sample at %.2fs failed: %v", start, err)
+            continue
+        }
+
+        matches := cropdetectLine.FindAllStringSubmatch(output, -1)
+        if len(matches) == 0 {
+            continue
+        }
+        last := matches[len(matches)-1]
+        width, _ := strconv.Atoi(last[1])
+        height, _ := strconv.Atoi(last[2])
+        x, _ := strconv.Atoi(last[3])
+        y, _ := strconv.Atoi(last[4])
+
+        counts[CropRect{Width: width, Height: height, X: x, Y: y}]++
+        sampled++
+    }
+
+    var best CropRect
+    bestCount := 0
+    for crop, count := range counts {
+        if count > bestCount {
+            best, bestCount = crop, count
+        }
+    }
+
+    if sampled == 0 || bestCount*2 <= sampled {
+        log.Printf("No stable crop found across %d samples", sampled)
+        return nil
+    }
+    return &best
+}
+
+func (p *Processor) cropFilter() string {
+    if p.Crop == nil {
+        return ""
+    }
+    return p.Crop.filter() + ","
+}
\ No newline at end of file
@@ -0,0 +1,183 @@
+package transcoder
+
+import (
+    "context"
+    "encoding/hex"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+
+    "github.com/pkalsi97/ShortRelay/backend/workers/processor/internal/encryption"
+)
+
+const (
+    EncryptionAES128    = "AES-128"
+    EncryptionSampleAES = "SAMPLE-AES"
+)
+
+const (
+    drmLabelVideo = "VIDEO"
+    drmLabelAudio = "AUDIO"
+)
+
+func (p *Processor) encryptionMethod() string {
+    if p.Config.Encryption == nil {
+        return ""
+    }
+    return p.Config.Encryption.Method
+}
+
+func (p *Processor) prepareEncryption() error {
+    if p.Config.DRM != nil {
+        if p.Config.Encryption != nil {
+            return fmt.Errorf("HLS encryption and DRM packaging are mutually exclusive")
+        }
+        return p.prepareDRM()
+    }
+
+    config := p.Config.Encryption
+    if config == nil || p.ContentKey != nil {
+        return nil
+    }
+
+    switch config.Method {
+    case EncryptionAES128, EncryptionSampleAES:
+    default:
+        return fmt.Errorf("unsupported encryption method: %s", config.Method)
+    }
+    if config.KeyStore == nil {
+        return fmt.Errorf("encryption requires a key store")
+    }
+    if config.KeyURLTemplate == "" {
+        return fmt.Errorf("encryption requires a key delivery URL template")
+    }
+
+    key, err := encryption.GenerateContentKey()
+    if err != nil {
+        return err
+    }
+
+    wrapped, err := key.Wrap(config.Method, config.WrappingKey)
+    if err != nil {
+        return fmt.Errorf("failed to wrap content key: %v", err)
+    }
+    if err := config.KeyStore.StoreKey(context.TODO(), config.AssetID, wrapped); err != nil {
+        return fmt.Errorf("failed to store content key: %v", err)
+    }
+
+    p.ContentKey = key
+    p.keyURI = encryption.ExpandKeyURL(config.KeyURLTemplate, config.UserID, config.AssetID, key.KeyIDHex())
+
+    if config.Method == EncryptionAES128 {
+        return p.writeKeyInfoFile()
+    }
+    return nil
+}
+
+// The key and key info files live outside the transcoded directory so the
+// clear key is never uploaded alongside the segments it protects.
+func (p *Processor) writeKeyInfoFile() error {
+    if err := os.MkdirAll(p.Paths.KeysDir, 0700); err != nil {
+        return fmt.Errorf("failed to create keys directory: %v", err)
+    }
+
+    keyFile := filepath.Join(p.Paths.KeysDir, "content.key")
+    if err := os.WriteFile(keyFile, p.ContentKey.Key, 0600); err != nil {
+        return fmt.Errorf("failed to write key file: %v", err)
+    }
+
+    keyInfo := strings.Join([]string{p.keyURI, keyFile, p.ContentKey.IVHex()}, "\n") + "\n"
+    if err := os.WriteFile(p.keyInfoPath(), []byte(keyInfo), 0600); err != nil {
+        return fmt.Errorf("failed to write key info file: %v", err)
+    }
+    return nil
+}
+
+func (p *Processor) keyInfoPath() string {
+    return filepath.Join(p.Paths.KeysDir, "key_info")
+}
+
+func (p *Processor) hlsEncryptionArgs() []string {
+    if p.ContentKey == nil || p.encryptionMethod() != EncryptionAES128 {
+        return nil
+    }
+    return []string{"-hls_key_info_file", p.keyInfoPath()}
+}
+
+func (p *Processor) sampleAESArgs() []string {
+    return []string{
+        "--protection_scheme", "cbcs",
+        "--enable_raw_key_encryption",
+        "--keys", fmt.Sprintf("label=:key_id=%s:key=%s", p.ContentKey.KeyIDHex(), p.ContentKey.KeyHex()),
+        "--iv", p.ContentKey.IVHex(),
+        "--clear_lead", "0",
+        "--hls_key_uri", p.keyURI,
+    }
+}
+
+func (p *Processor) prepareDRM() error {
+    config := p.Config.DRM
+    if p.DRMKeys != nil {
+        return nil
+    }
+
+    switch config.Scheme {
+    case encryption.SchemeCENC, encryption.SchemeCBCS:
+    default:
+        return fmt.Errorf("unsupported DRM scheme: %s", config.Scheme)
+    }
+    if config.Provider == nil {
+        return fmt.Errorf("DRM packaging requires a key provider")
+    }
+
+    keys, err := config.Provider.GetKeys(context.TODO(), config.AssetID, []string{drmLabelVideo, drmLabelAudio})
+    if err != nil {
+        return fmt.Errorf("failed to get DRM keys: %v", err)
+    }
+    if len(keys.Keys) == 0 {
+        return fmt.Errorf("key provider returned no DRM keys")
+    }
+
+    p.DRMKeys = keys
+    return nil
+}
+
+func (p *Processor) drmArgs() []string {
+    keys := make([]string, 0, len(p.DRMKeys.Keys))
+    for _, key := range p.DRMKeys.Keys {
+        keys = append(keys, fmt.Sprintf("label=%s:key_id=%s:key=%s",
+            key.Label, hex.EncodeToString(key.KeyID), hex.EncodeToString(key.Key)))
+    }
+
+    args := []string{
+        "--protection_scheme", p.Config.DRM.Scheme,
+        "--enable_raw_key_encryption",
+        "--keys", strings.Join(keys, ","),
+        "--clear_lead", "0",
+    }
+
+    if len(p.DRMKeys.PSSH) > 0 {
+        var pssh []byte
+        for _, box := range p.DRMKeys.PSSH {
+            pssh = append(pssh, box...)
+        }
+        args = append(args, "--pssh", hex.EncodeToString(pssh))
+    }
+    if p.DRMKeys.HLSKeyURI != "" {
+        args = append(args, "--hls_key_uri", p.DRMKeys.HLSKeyURI)
+    }
+    return args
+}
+
+// packagerProtectionArgs returns the packager flags for modes that need
+// sample-level encryption, or nil when ffmpeg can package the output itself.
+func (p *Processor) packagerProtectionArgs() []string {
+    if p.DRMKeys != nil {
+        return p.drmArgs()
+    }
+    if p.ContentKey != nil && p.encryptionMethod() == EncryptionSampleAES {
+        return p.sampleAESArgs()
+    }
+    return nil
+}
\ No newline at end of file
@@ -1,6 +1,8 @@
 package transcoder
 
 import (
+    "bytes"
+    "context"
     "encoding/json"
     "fmt"
     "os"
@@ -10,10 +12,47 @@ import (
 )
 
 func runFFmpeg(args []string) error {
-    cmd := exec.Command("ffmpeg", args...)
+    return runFFmpegContext(context.Background(), args)
+}
+
+// runFFmpegContext kills ffmpeg when ctx is cancelled.
+func runFFmpegContext(ctx context.Context, args []string) error {
+    cmd := exec.CommandContext(ctx, "ffmpeg", args...)
     cmd.Stdout = os.Stdout
     cmd.Stderr = os.Stderr
-    return cmd.Run()
+    return commandError(ctx, cmd.Run())
+}
+
+// commandError reports a command killed by the cancellation of ctx as that
+// cancellation, so the scheduler can tell it from a failure of its own.
+func commandError(ctx context.Context, err error) error {
+    if err != nil && ctx.Err() != nil {
+        return fmt.Errorf("%w: %v", ctx.Err(), err)
+    }
+    return err
+}
+
+func runFFmpegCapture(args []string) (string, error) {
+    return runFFmpegCaptureContext(context.Background(), args)
+}
+
+func runFFmpegCaptureContext(ctx context.Context, args []string) (string, error) {
+    var stderr bytes.Buffer
+    cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+    cmd.Stdout = os.Stdout
+    cmd.Stderr = &stderr
+    if err := cmd.Run(); err != nil {
+        return stderr.String(), fmt.Errorf("%w: %s", commandError(ctx, err), lastLines(stderr.String(), 5))
+    }
+    return stderr.String(), nil
+}
+
+func lastLines(output string, count int) string {
+    lines := strings.Split(strings.TrimSpace(output), "\n")
+    if len(lines) > count {
+        lines = lines[len(lines)-count:]
+    }
+    return strings.Join(lines, " | ")
 }
 
 func runFFprobe(args []string) ([]byte, error) {
@@ -25,7 +64,7 @@ func getVideoInfo(inputPath string) (*VideoInfo, error) {
     probeCmd := exec.Command("ffprobe",
         "-v", "error",
         "-select_streams", "v:0",
-        "-show_entries", "stream=width,height,display_aspect_ratio:format=duration",
+        "-show_entries", "stream=width,height,display_aspect_ratio,closed_captions,r_frame_rate,avg_frame_rate,field_order:format=duration",
         "-of", "json",
         inputPath)
 
@@ -39,6 +78,10 @@ func getVideoInfo(inputPath string) (*VideoInfo, error) {
             Width       int    `json:"width"`
             Height      int    `json:"height"`
             AspectRatio string `json:"display_aspect_ratio"`
+            ClosedCaptions int `json:"closed_captions"`
+            RFrameRate   string `json:"r_frame_rate"`
+            AvgFrameRate string `json:"avg_frame_rate"`
+            FieldOrder   string `json:"field_order"`
         } `json:"streams"`
         Format struct {
             Duration string `json:"duration"`
@@ -54,23 +97,122 @@ func getVideoInfo(inputPath string) (*VideoInfo, error) {
         return nil, fmt.Errorf("no video streams found")
     }
 
-    audioProbeCmd := exec.Command("ffprobe",
-        "-v", "error",
-        "-select_streams", "a:0",
-        "-show_entries", "stream=codec_type",
-        "-of", "json",
-        inputPath)
+    audioStreams := getAudioStreams(inputPath)
 
-    audioOutput, _ := audioProbeCmd.Output()
-    hasAudio := strings.Contains(string(audioOutput), "audio")
+    subtitleStreams := getSubtitleStreams(inputPath)
+    if data.Streams[0].ClosedCaptions == 1 {
+        subtitleStreams = append(subtitleStreams, SubtitleStream{
+            Index:           -1,
+            Codec:           "eia_608",
+            IsClosedCaption: true,
+        })
+    }
 
     duration, _ := strconv.ParseFloat(data.Format.Duration, 64)
 
     return &VideoInfo{
-        Width:      data.Streams[0].Width,
-        Height:     data.Streams[0].Height,
-        Duration:   duration,
-        HasAudio:   hasAudio,
-        IsVertical: data.Streams[0].Height > data.Streams[0].Width,
+        Width:        data.Streams[0].Width,
+        Height:       data.Streams[0].Height,
+        Duration:     duration,
+        HasAudio:     len(audioStreams) > 0,
+        IsVertical:   data.Streams[0].Height > data.Streams[0].Width,
+        AudioStreams: audioStreams,
+        FrameRate:    parseFrameRate(data.Streams[0].RFrameRate),
+        AvgFrameRate: parseFrameRate(data.Streams[0].AvgFrameRate),
+        FieldOrder:   data.Streams[0].FieldOrder,
+
+        SubtitleStreams: subtitleStreams,
     }, nil
+}
+
+func getAudioStreams(inputPath string) []AudioStream {
+    output, err := runFFprobe([]string{
+        "-v", "error",
+        "-select_streams", "a",
+        "-show_entries", "stream=codec_name,channels:stream_tags=language,title:stream_disposition=default,comment",
+        "-of", "json",
+        inputPath,
+    })
+    if err != nil {
+        return nil
+    }
+
+    type ProbeData struct {
+        Streams []struct {
+            CodecName string `json:"codec_name"`
+            Channels  int    `json:"channels"`
+            Tags      struct {
+                Language string `json:"language"`
+                Title    string `json:"title"`
+            } `json:"tags"`
+            Disposition struct {
+                Default int `json:"default"`
+                Comment int `json:"comment"`
+            } `json:"disposition"`
+        } `json:"streams"`
+    }
+
+    var data ProbeData
+    if err := json.Unmarshal(output, &data); err != nil {
+        return nil
+    }
+
+    streams := make([]AudioStream, 0, len(data.Streams))
+    for i, s := range data.Streams {
+        streams = append(streams, AudioStream{
+            Index:        i,
+            Codec:        s.CodecName,
+            Channels:     s.Channels,
+            Language:     s.Tags.Language,
+            Title:        s.Tags.Title,
+            IsDefault:    s.Disposition.Default == 1,
+            IsCommentary: s.Disposition.Comment == 1,
+        })
+    }
+    return streams
+}
+
+func getSubtitleStreams(inputPath string) []SubtitleStream {
+    output, err := runFFprobe([]string{
+        "-v", "error",
+        "-select_streams", "s",
+        "-show_entries", "stream=codec_name:stream_tags=language,title:stream_disposition=default,forced",
+        "-of", "json",
+        inputPath,
+    })
+    if err != nil {
+        return nil
+    }
+
+    type ProbeData struct {
+        Streams []struct {
+            CodecName string `json:"codec_name"`
+            Tags      struct {
+                Language string `json:"language"`
+                Title    string `json:"title"`
+            } `json:"tags"`
+            Disposition struct {
+                Default int `json:"default"`
+                Forced  int `json:"forced"`
+            } `json:"disposition"`
+        } `json:"streams"`
+    }
+
+    var data ProbeData
+    if err := json.Unmarshal(output, &data); err != nil {
+        return nil
+    }
+
+    streams := make([]SubtitleStream, 0, len(data.Streams))
+    for i, s := range data.Streams {
+        streams = append(streams, SubtitleStream{
+            Index:     i,
+            Codec:     s.CodecName,
+            Language:  s.Tags.Language,
+            Title:     s.Tags.Title,
+            IsDefault: s.Disposition.Default == 1,
+            IsForced:  s.Disposition.Forced == 1,
+        })
+    }
+    return streams
 }
\ No newline at end of file
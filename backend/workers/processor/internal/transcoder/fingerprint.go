@@ -0,0 +1,15 @@
+package transcoder
+
+import (
+    "github.com/pkalsi97/ShortRelay/backend/workers/processor/internal/fingerprint"
+)
+
+// Fingerprint hashes the media as it will be encoded, after any trim or
+// concatenation, so re-uploads that ask for the same edit still match.
+func (p *Processor) Fingerprint() (*fingerprint.Signature, error) {
+    audioStream := -1
+    if len(p.AudioTracks) > 0 {
+        audioStream = p.defaultAudioTrack().StreamIndex
+    }
+    return fingerprint.Compute(p.InputPath, p.VideoInfo.Duration, audioStream)
+}
\ No newline at end of file
@@ -0,0 +1,159 @@
+package transcoder
+
+import (
+    "fmt"
+    "log"
+    "math"
+    "regexp"
+    "strconv"
+    "strings"
+)
+
+const (
+    DeinterlaceBwdif = "bwdif"
+    DeinterlaceYadif = "yadif"
+
+    defaultFrameRate = 30.0
+    maxFrameRate     = 60.0
+    idetFrames       = 600
+    vfrTolerance     = 0.01
+)
+
+var idetMultiFrame = regexp.MustCompile(`Multi frame detection:\s*TFF:\s*(\d+)\s*BFF:\s*(\d+)\s*Progressive:\s*(\d+)`)
+
+// FrameCadence records what the encode does to the source timing so it can be
+// stored alongside the asset.
+type FrameCadence struct {
+    Interlaced   bool
+    FieldOrder   string
+    VariableRate bool
+    SourceRate   float64
+    OutputRate   float64
+    Deinterlacer string
+}
+
+func parseFrameRate(value string) float64 {
+    parts := strings.SplitN(value, "/", 2)
+    numerator, err := strconv.ParseFloat(parts[0], 64)
+    if err != nil {
+        return 0
+    }
+    if len(parts) == 1 {
+        return numerator
+    }
+    denominator, err := strconv.ParseFloat(parts[1], 64)
+    if err != nil || denominator == 0 {
+        return 0
+    }
+    return numerator / denominator
+}
+
+func (p *Processor) analyzeCadence() error {
+    deinterlacer := p.Config.Deinterlacer
+    switch deinterlacer {
+    case "":
+        deinterlacer = DeinterlaceBwdif
+    case DeinterlaceBwdif, DeinterlaceYadif:
+    default:
+        return fmt.Errorf("unknown deinterlacer: %s", deinterlacer)
+    }
+
+    info := p.VideoInfo
+    cadence := FrameCadence{
+        FieldOrder: info.FieldOrder,
+        SourceRate: info.AvgFrameRate,
+    }
+
+    // r_frame_rate is the lowest rate that represents every timestamp, so a
+    // different average means frames are not evenly spaced.
+    if info.FrameRate > 0 && info.AvgFrameRate > 0 &&
+        math.Abs(info.FrameRate-info.AvgFrameRate)/info.FrameRate > vfrTolerance {
+        cadence.VariableRate = true
+    }
+
+    interlaced, err := p.detectInterlacing()
+    if err != nil {
+        // Fall back to the container's field order when idet cannot run.
+        log.Printf("Interlace detection failed: %v", err)
+        interlaced = info.FieldOrder != "" && info.FieldOrder != "progressive" && info.FieldOrder != "unknown"
+    }
+    cadence.Interlaced = interlaced
+    if interlaced {
+        cadence.Deinterlacer = deinterlacer
+    }
+
+    cadence.OutputRate = p.Config.FrameRate
+    if cadence.OutputRate == 0 {
+        cadence.OutputRate = info.AvgFrameRate
+        if cadence.VariableRate || cadence.OutputRate <= 0 || cadence.OutputRate > maxFrameRate {
+            cadence.OutputRate = defaultFrameRate
+        }
+    }
+
+    p.Cadence = cadence
+    return nil
+}
+
+// detectInterlacing runs idet over the opening frames and trusts its
+// multi-frame verdict, which is less noisy than the single-frame counts.
+func (p *Processor) detectInterlacing() (bool, error) {
+    args := []string{
+        "-hide_banner",
+        "-nostats",
+        "-v", "info",
+        "-i", p.InputPath,
+        "-an",
+        "-frames:v", fmt.Sprintf("%d", idetFrames),
+        "-vf", "idet",
+        "-f", "null",
+        "-",
+    }
+
+    output, err := runFFmpegCapture(args)
+    if err != nil {
+        return false, err
+    }
+
+    match := idetMultiFrame.FindStringSubmatch(output)
+    if match == nil {
+        return false, fmt.Errorf("idet statistics not found in ffmpeg output")
+    }
+    tff, _ := strconv.Atoi(match[1])
+    bff, _ := strconv.Atoi(match[2])
+    progressive, _ := strconv.Atoi(match[3])
+
+    return tff+bff > progressive, nil
+}
+
+// cadenceFilter deinterlaces to one frame per frame and resamples to the
+// output rate, ahead of cropping and scaling.
+func (p *Processor) cadenceFilter() string {
+    var filters []string
+    if p.Cadence.Interlaced {
+        filters = append(filters, fmt.Sprintf("%s=mode=send_frame:parity=auto:deint=all", p.Cadence.Deinterlacer))
+    }
+    if p.Cadence.OutputRate > 0 {
+        filters = append(filters, fmt.Sprintf("fps=%s", formatFrameRate(p.Cadence.OutputRate)))
+    }
+    if len(filters) == 0 {
+        return ""
+    }
+    return strings.Join(filters, ",") + ","
+}
+
+func (p *Processor) outputFrameRate() float64 {
+    if p.Cadence.OutputRate > 0 {
+        return p.Cadence.OutputRate
+    }
+    return defaultFrameRate
+}
+
+// keyframeInterval converts the profile's GOP to frames, so keyframes land on
+// segment boundaries at any output rate.
+func (p *Processor) keyframeInterval() int {
+    return int(math.Round(p.outputFrameRate() * p.profile().Video.GOP))
+}
+
+func formatFrameRate(rate float64) string {
+    return strconv.FormatFloat(math.Round(rate*1000)/1000, 'f', -1, 64)
+}
\ No newline at end of file
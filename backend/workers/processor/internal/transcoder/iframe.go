@@ -0,0 +1,160 @@
+package transcoder
+
+import (
+    "fmt"
+    "math"
+    "os"
+    "path/filepath"
+    "strings"
+
+    "github.com/pkalsi97/ShortRelay/backend/workers/processor/internal/mp4"
+)
+
+type iframeEntry struct {
+    Segment    string
+    Offset     int64
+    Length     int64
+    DecodeTime uint64
+    Duration   float64
+}
+
+// generateByteRangeIframePlaylist indexes the keyframes already present in a
+// rendition's fMP4 segments. Each entry's byte range starts at the moof that
+// describes the keyframe and ends with the keyframe's sample data, which is
+// all a player needs to decode it. Single-file renditions are read whole, since
+// fragment offsets are already relative to that file. Returns the peak I-frame
+// bit rate.
+func (p *Processor) generateByteRangeIframePlaylist(res Resolution) (int, error) {
+    streamDir := filepath.Join(p.Paths.HLSDir, "video", res.Name)
+    data, err := os.ReadFile(filepath.Join(streamDir, "stream.m3u8"))
+    if err != nil {
+        return 0, fmt.Errorf("failed to read media playlist %s: %v", res.Name, err)
+    }
+
+    var mapURI, mapLine string
+    var keyLines, segments []string
+    seen := make(map[string]bool)
+    for _, line := range strings.Split(string(data), "\n") {
+        line = strings.TrimSpace(line)
+        switch {
+        case strings.HasPrefix(line, "#EXT-X-MAP:"):
+            mapURI, mapLine = playlistAttribute(line, "URI"), line
+        case strings.HasPrefix(line, "#EXT-X-KEY:"):
+            keyLines = append(keyLines, line)
+        case line != "" && !strings.HasPrefix(line, "#") && !seen[line]:
+            seen[line] = true
+            segments = append(segments, line)
+        }
+    }
+    if mapURI == "" || len(segments) == 0 {
+        return 0, fmt.Errorf("media playlist %s has no fMP4 segments", res.Name)
+    }
+
+    init, err := os.ReadFile(filepath.Join(streamDir, mapURI))
+    if err != nil {
+        return 0, fmt.Errorf("failed to read init segment %s: %v", res.Name, err)
+    }
+    tracks, err := mp4.ReadTracks(init)
+    if err != nil {
+        return 0, fmt.Errorf("failed to parse init segment %s: %v", res.Name, err)
+    }
+    track, ok := videoTrack(tracks)
+    if !ok || track.Timescale == 0 {
+        return 0, fmt.Errorf("no video track in %s", res.Name)
+    }
+
+    var entries []iframeEntry
+    var end uint64
+    for _, segment := range segments {
+        segmentData, err := os.ReadFile(filepath.Join(streamDir, segment))
+        if err != nil {
+            return 0, fmt.Errorf("failed to read segment %s: %v", segment, err)
+        }
+        samples, err := mp4.ReadSamples(segmentData, track)
+        if err != nil {
+            return 0, fmt.Errorf("failed to parse segment %s: %v", segment, err)
+        }
+
+        for _, sample := range samples {
+            if sample.Sync {
+                entries = append(entries, iframeEntry{
+                    Segment:    segment,
+                    Offset:     sample.MoofOffset,
+                    Length:     sample.Offset + int64(sample.Size) - sample.MoofOffset,
+                    DecodeTime: sample.DecodeTime,
+                })
+            }
+            end = sample.DecodeTime + uint64(sample.Duration)
+        }
+    }
+    if len(entries) == 0 {
+        return 0, fmt.Errorf("no keyframes found in %s", res.Name)
+    }
+
+    // An I-frame lasts until the next one, the last until the end of media.
+    peak, longest := 0, 0.0
+    for i := range entries {
+        next := end
+        if i+1 < len(entries) {
+            next = entries[i+1].DecodeTime
+        }
+        entries[i].Duration = float64(next-entries[i].DecodeTime) / float64(track.Timescale)
+        longest = math.Max(longest, entries[i].Duration)
+        if entries[i].Duration > 0 {
+            if bitrate := int(float64(entries[i].Length*8) / entries[i].Duration); bitrate > peak {
+                peak = bitrate
+            }
+        }
+    }
+
+    playlist := []string{
+        "#EXTM3U",
+        "#EXT-X-VERSION:7",
+        fmt.Sprintf("#EXT-X-TARGETDURATION:%d", int(math.Ceil(longest))),
+        "#EXT-X-MEDIA-SEQUENCE:0",
+        "#EXT-X-PLAYLIST-TYPE:VOD",
+        "#EXT-X-I-FRAMES-ONLY",
+    }
+    playlist = append(playlist, keyLines...)
+    playlist = append(playlist, mapLine)
+    for _, entry := range entries {
+        playlist = append(playlist,
+            fmt.Sprintf("#EXTINF:%.5f,", entry.Duration),
+            fmt.Sprintf("#EXT-X-BYTERANGE:%d@%d", entry.Length, entry.Offset),
+            entry.Segment)
+    }
+    playlist = append(playlist, "#EXT-X-ENDLIST")
+
+    if err := os.WriteFile(filepath.Join(streamDir, "iframe.m3u8"), []byte(strings.Join(playlist, "\n")+"\n"), 0644); err != nil {
+        return 0, err
+    }
+    return peak, nil
+}
+
+func videoTrack(tracks []mp4.Track) (mp4.Track, bool) {
+    for _, track := range tracks {
+        if track.Handler == "vide" {
+            return track, true
+        }
+    }
+    if len(tracks) > 0 {
+        return tracks[0], true
+    }
+    return mp4.Track{}, false
+}
+
+func (p *Processor) iframeStreamInf(res Resolution, bandwidth int) string {
+    return fmt.Sprintf("#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d,"+
+        "CODECS=\"%s\",URI=\"video/%s/iframe.m3u8\"",
+        bandwidth, res.Width, res.Height, p.videoCodec(res), res.Name)
+}
+
+func playlistAttribute(line, name string) string {
+    for _, attribute := range strings.Split(line[strings.Index(line, ":")+1:], ",") {
+        key, value, ok := strings.Cut(attribute, "=")
+        if ok && key == name {
+            return strings.Trim(value, "\"")
+        }
+    }
+    return ""
+}
\ No newline at end of file
@@ -0,0 +1,138 @@
+package transcoder
+
+import (
+    "context"
+    "fmt"
+    "path/filepath"
+    "strings"
+)
+
+const (
+    EncodeModeAuto         = "auto"
+    EncodeModeSequential   = "sequential"
+    EncodeModeSingleDecode = "single_decode"
+
+    // Below this many cores the ladder encoders of a single-decode run starve
+    // each other, and encoding one rendition at a time with every core is
+    // faster. The default is an estimate; cmd/encodebench times both modes on
+    // a given machine, and SINGLE_DECODE_MIN_CPUS sets the measured value.
+    SingleDecodeMinCPUs = 8
+)
+
+var DefaultLadder = []Resolution{
+    {Name: "1080p", Width: 1920, Height: 1080, Bitrate: "3000k"},
+    {Name: "720p", Width: 1280, Height: 720, Bitrate: "2000k"},
+    {Name: "480p", Width: 854, Height: 480, Bitrate: "800k"},
+    {Name: "360p", Width: 640, Height: 360, Bitrate: "400k"},
+}
+
+// ParseEncodeMode accepts an empty value as auto.
+func ParseEncodeMode(value string) (string, error) {
+    switch value {
+    case "", EncodeModeAuto:
+        return EncodeModeAuto, nil
+    case EncodeModeSequential, EncodeModeSingleDecode:
+        return value, nil
+    default:
+        return "", fmt.Errorf("unsupported encode mode: %s", value)
+    }
+}
+
+// EncodeMode resolves auto against the thread budget.
+func (p *Processor) EncodeMode() string {
+    switch p.Config.EncodeMode {
+    case EncodeModeSequential, EncodeModeSingleDecode:
+        return p.Config.EncodeMode
+    }
+    if p.threadBudget() >= p.singleDecodeMinCPUs() && len(p.Resolutions) > 1 {
+        return EncodeModeSingleDecode
+    }
+    return EncodeModeSequential
+}
+
+func (p *Processor) singleDecodeMinCPUs() int {
+    if p.Config.SingleDecodeMinCPUs > 0 {
+        return p.Config.SingleDecodeMinCPUs
+    }
+    return SingleDecodeMinCPUs
+}
+
+// ladderScale fixes one side of a rendition and lets ffmpeg derive the other.
+func (p *Processor) ladderScale(res Resolution) string {
+    if p.VideoInfo.IsVertical {
+        return fmt.Sprintf("scale=-2:%d", res.Height)
+    }
+    return fmt.Sprintf("scale=%d:-2", res.Width)
+}
+
+// generateMP4Ladder decodes the source once and splits the frames across one
+// scaler and encoder per rendition, all in a single ffmpeg process whose
+// threads are shared out between the encoders. Two-pass rungs need their logs
+// before the real encode, so they first get a decode of their own.
+func (p *Processor) generateMP4Ladder(ctx context.Context, inputPath string, threads int) error {
+    var twoPass []Resolution
+    for _, res := range p.Resolutions {
+        if res.RateControl == RateControlTwoPass {
+            twoPass = append(twoPass, res)
+        }
+    }
+
+    if len(twoPass) > 0 {
+        if err := runFFmpegContext(ctx, p.ladderArgs(inputPath, twoPass, threads, true)); err != nil {
+            return fmt.Errorf("single-decode first pass failed: %w", err)
+        }
+    }
+    if err := runFFmpegContext(ctx, p.ladderArgs(inputPath, p.Resolutions, threads, false)); err != nil {
+        return fmt.Errorf("single-decode encode failed: %w", err)
+    }
+    return nil
+}
+
+func (p *Processor) ladderArgs(inputPath string, rungs []Resolution, threads int, firstPass bool) []string {
+    count := len(rungs)
+    sources := make([]string, count)
+    logos := make([]string, count)
+    for i := range rungs {
+        sources[i] = fmt.Sprintf("[s%d]", i)
+        logos[i] = fmt.Sprintf("[logo%d]", i)
+    }
+
+    graph := []string{
+        fmt.Sprintf("[0:v]%s%ssplit=%d%s", p.cadenceFilter(), p.cropFilter(), count, strings.Join(sources, "")),
+    }
+    if p.Config.Watermark != nil {
+        graph = append(graph, fmt.Sprintf("[1:v]split=%d%s", count, strings.Join(logos, "")))
+    }
+    for i, res := range rungs {
+        if p.Config.Watermark != nil {
+            graph = append(graph,
+                fmt.Sprintf("[s%d]%s[base%d]", i, p.ladderScale(res), i),
+                p.watermarkOverlay(fmt.Sprintf("logo%d", i), fmt.Sprintf("base%d", i), fmt.Sprintf("v%d", i), p.outputHeight(res)))
+        } else {
+            graph = append(graph, fmt.Sprintf("[s%d]%s,format=yuv420p[v%d]", i, p.ladderScale(res), i))
+        }
+    }
+
+    args := []string{
+        "-v", "error",
+        "-i", inputPath,
+    }
+    if p.Config.Watermark != nil {
+        args = append(args, "-i", p.Config.Watermark.ImagePath)
+    }
+    args = append(args, "-filter_complex", strings.Join(graph, ";"))
+
+    shares := threadShares(rungs, threads)
+    for i, res := range rungs {
+        passes := encodePasses(res, p.passLog(res.Name))
+        pass := passes[len(passes)-1]
+        if firstPass {
+            pass = passes[0]
+        }
+
+        outputFile := filepath.Join(p.Paths.MP4Dir, fmt.Sprintf("%s.mp4", res.Name))
+        args = append(args, "-map", fmt.Sprintf("[v%d]", i))
+        args = append(args, p.videoEncodeArgs(res, outputFile, shares[i], pass)...)
+    }
+    return args
+}
\ No newline at end of file
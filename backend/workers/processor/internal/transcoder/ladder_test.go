@@ -0,0 +1,29 @@
+package transcoder
+
+import "testing"
+
+func TestEncodeMode(t *testing.T) {
+    tests := []struct {
+        name       string
+        config     ProcessorConfig
+        renditions int
+        want       string
+    }{
+        {name: "auto below the default", config: ProcessorConfig{ThreadBudget: 4}, renditions: 4, want: EncodeModeSequential},
+        {name: "auto at the default", config: ProcessorConfig{ThreadBudget: 8}, renditions: 4, want: EncodeModeSingleDecode},
+        {name: "measured threshold", config: ProcessorConfig{ThreadBudget: 8, SingleDecodeMinCPUs: 16}, renditions: 4, want: EncodeModeSequential},
+        {name: "lowered threshold", config: ProcessorConfig{ThreadBudget: 4, SingleDecodeMinCPUs: 4}, renditions: 4, want: EncodeModeSingleDecode},
+        {name: "single rendition", config: ProcessorConfig{ThreadBudget: 32}, renditions: 1, want: EncodeModeSequential},
+        {name: "forced", config: ProcessorConfig{ThreadBudget: 2, EncodeMode: EncodeModeSingleDecode}, renditions: 4, want: EncodeModeSingleDecode},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            config := test.config
+            p := &Processor{Config: &config, Resolutions: DefaultLadder[:test.renditions]}
+            if mode := p.EncodeMode(); mode != test.want {
+                t.Errorf("EncodeMode = %s, want %s", mode, test.want)
+            }
+        })
+    }
+}
\ No newline at end of file
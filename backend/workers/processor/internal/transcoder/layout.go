@@ -0,0 +1,43 @@
+package transcoder
+
+import (
+    "fmt"
+)
+
+const (
+    HLSLayoutSegmented  = "segmented"
+    HLSLayoutSingleFile = "single_file"
+
+    singleFileSegment = "stream.m4s"
+)
+
+// ParseHLSLayout accepts an empty value as the segmented default.
+func ParseHLSLayout(value string) (string, error) {
+    switch value {
+    case "", HLSLayoutSegmented:
+        return HLSLayoutSegmented, nil
+    case HLSLayoutSingleFile:
+        return HLSLayoutSingleFile, nil
+    default:
+        return "", fmt.Errorf("unsupported HLS layout: %s", value)
+    }
+}
+
+func (p *Processor) singleFile() bool {
+    return p.Config.HLSLayout == HLSLayoutSingleFile
+}
+
+// hlsSegmentArgs names the media output of an fMP4 rendition. The single-file
+// layout keeps every fragment in one object, addressed by EXT-X-BYTERANGE.
+func (p *Processor) hlsSegmentArgs(flags string) []string {
+    if p.singleFile() {
+        return []string{
+            "-hls_flags", flags + "+single_file",
+            "-hls_segment_filename", singleFileSegment,
+        }
+    }
+    return []string{
+        "-hls_flags", flags,
+        "-hls_segment_filename", "data%03d.m4s",
+    }
+}
\ No newline at end of file
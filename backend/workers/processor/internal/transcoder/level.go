@@ -0,0 +1,73 @@
+package transcoder
+
+import (
+    "fmt"
+    "math"
+)
+
+// h264Levels are the limits of H.264 Table A-1 for the High profile: level_idc,
+// macroblocks per second, macroblocks per frame and peak bitrate in kbit/s.
+var h264Levels = []struct {
+    IDC     int
+    MaxMBPS int
+    MaxFS   int
+    MaxBR   int
+}{
+    {10, 1485, 99, 80},
+    {11, 3000, 396, 240},
+    {12, 6000, 396, 480},
+    {13, 11880, 396, 960},
+    {20, 11880, 396, 2500},
+    {21, 19800, 792, 5000},
+    {22, 20250, 1620, 5000},
+    {30, 40500, 1620, 12500},
+    {31, 108000, 3600, 17500},
+    {32, 216000, 5120, 25000},
+    {40, 245760, 8192, 25000},
+    {41, 245760, 8192, 62500},
+    {42, 522240, 8704, 62500},
+    {50, 589824, 22080, 168750},
+    {51, 983040, 36864, 300000},
+    {52, 2073600, 36864, 300000},
+}
+
+// h264Level returns the lowest level_idc whose limits fit a rendition. A zero
+// frame rate leaves the macroblock rate unchecked.
+func h264Level(width, height int, frameRate float64, bitrate int) (int, error) {
+    mbWidth, mbHeight := (width+15)/16, (height+15)/16
+    frameSize := mbWidth * mbHeight
+    for _, level := range h264Levels {
+        // Neither side may exceed sqrt(8 * MaxFS) macroblocks.
+        maxSide := int(math.Sqrt(float64(level.MaxFS * 8)))
+        if frameSize > level.MaxFS || mbWidth > maxSide || mbHeight > maxSide {
+            continue
+        }
+        if float64(frameSize)*frameRate > float64(level.MaxMBPS) || bitrate > level.MaxBR {
+            continue
+        }
+        return level.IDC, nil
+    }
+    return 0, fmt.Errorf("%dx%d at %dk exceeds H.264 level 5.2", width, height, bitrate)
+}
+
+// h264Level picks the level for a ladder rendition. Profile.Validate has
+// checked the size and bitrate, so only a frame rate beyond level 5.2 fails
+// here, and the stream is then signalled as 5.2.
+func (p *Processor) h264Level(res Resolution) int {
+    level, err := h264Level(res.Width, res.Height, p.outputFrameRate(), peakBandwidth(res)/1000)
+    if err != nil {
+        return h264Levels[len(h264Levels)-1].IDC
+    }
+    return level
+}
+
+func (p *Processor) levelArg(res Resolution) string {
+    level := p.h264Level(res)
+    return fmt.Sprintf("%d.%d", level/10, level%10)
+}
+
+// videoCodec is the CODECS entry of a rendition: High profile, no constraint
+// flags, and its level.
+func (p *Processor) videoCodec(res Resolution) string {
+    return fmt.Sprintf("avc1.6400%02x", p.h264Level(res))
+}
\ No newline at end of file
@@ -0,0 +1,62 @@
+package transcoder
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestH264Level(t *testing.T) {
+    tests := []struct {
+        name      string
+        width     int
+        height    int
+        frameRate float64
+        bitrate   int
+        level     int
+    }{
+        {name: "1080p30", width: 1920, height: 1080, frameRate: 30, bitrate: 3000, level: 40},
+        {name: "1080p30 above 25 Mbit/s", width: 1920, height: 1080, frameRate: 30, bitrate: 30000, level: 41},
+        {name: "1080p60", width: 1920, height: 1080, frameRate: 60, bitrate: 6000, level: 42},
+        {name: "vertical 1080x1920", width: 1080, height: 1920, frameRate: 30, bitrate: 3000, level: 40},
+        {name: "720p30", width: 1280, height: 720, frameRate: 30, bitrate: 1500, level: 31},
+        {name: "2160p30", width: 3840, height: 2160, frameRate: 30, bitrate: 12000, level: 51},
+        {name: "360p30", width: 640, height: 360, frameRate: 30, bitrate: 400, level: 30},
+        {name: "side limit sets the level", width: 4096, height: 64, frameRate: 30, bitrate: 1000, level: 40},
+        {name: "4320p", width: 7680, height: 4320, frameRate: 30, bitrate: 40000},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            level, err := h264Level(test.width, test.height, test.frameRate, test.bitrate)
+            if test.level == 0 {
+                if err == nil {
+                    t.Errorf("h264Level = %d, want an error", level)
+                }
+                return
+            }
+            if err != nil || level != test.level {
+                t.Errorf("h264Level = %d, %v; want %d", level, err, test.level)
+            }
+        })
+    }
+}
+
+func TestRenditionCodec(t *testing.T) {
+    profile := DefaultProfile()
+    p := &Processor{Config: &ProcessorConfig{Profile: &profile}, Cadence: FrameCadence{OutputRate: 60}}
+    res := Resolution{Name: "1080p", Width: 1920, Height: 1080, Bitrate: "6000k"}
+    if codec := p.videoCodec(res); codec != "avc1.64002a" {
+        t.Errorf("videoCodec = %s, want avc1.64002a", codec)
+    }
+    if level := p.levelArg(res); level != "4.2" {
+        t.Errorf("levelArg = %s, want 4.2", level)
+    }
+}
+
+func TestValidateRejectsUnleveledRendition(t *testing.T) {
+    profile := DefaultProfile()
+    profile.Renditions = []Resolution{{Name: "4320p", Width: 7680, Height: 4320, Bitrate: "40000k"}}
+    if err := profile.Validate(); err == nil || !strings.Contains(err.Error(), "exceeds H.264 level 5.2") {
+        t.Errorf("Validate = %v, want a level error", err)
+    }
+}
\ No newline at end of file
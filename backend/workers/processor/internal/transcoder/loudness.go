@@ -0,0 +1,148 @@
+package transcoder
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "math"
+    "strconv"
+    "strings"
+)
+
+var loudnessTargets = map[string]LoudnessTarget{
+    "mobile": {Integrated: -16, LoudnessRange: 11, TruePeak: -1.5},
+    // EBU R128 does not bound LRA; a wide target keeps loudnorm in linear mode.
+    "broadcast": {Integrated: -23, LoudnessRange: 20, TruePeak: -1},
+}
+
+func LoudnessTargetFor(name string) (LoudnessTarget, error) {
+    if name == "" {
+        name = "mobile"
+    }
+    target, ok := loudnessTargets[name]
+    if !ok {
+        return LoudnessTarget{}, fmt.Errorf("unknown loudness target: %s", name)
+    }
+    return target, nil
+}
+
+type loudnormOutput struct {
+    InputI            string `json:"input_i"`
+    InputTP           string `json:"input_tp"`
+    InputLRA          string `json:"input_lra"`
+    InputThresh       string `json:"input_thresh"`
+    OutputI           string `json:"output_i"`
+    OutputTP          string `json:"output_tp"`
+    OutputLRA         string `json:"output_lra"`
+    OutputThresh      string `json:"output_thresh"`
+    NormalizationType string `json:"normalization_type"`
+    TargetOffset      string `json:"target_offset"`
+}
+
+func (p *Processor) loudnessTarget() LoudnessTarget {
+    if p.Config.Loudness == (LoudnessTarget{}) {
+        target, _ := LoudnessTargetFor("")
+        return target
+    }
+    return p.Config.Loudness
+}
+
+func (p *Processor) measureLoudness(ctx context.Context, inputPath string, track AudioTrack) (*loudnormOutput, error) {
+    target := p.loudnessTarget()
+    filter := fmt.Sprintf("%s,loudnorm=I=%.1f:LRA=%.1f:TP=%.1f:print_format=json",
+        channelLayoutFilter(track), target.Integrated, target.LoudnessRange, target.TruePeak)
+
+    args := []string{
+        "-hide_banner",
+        "-nostats",
+        "-v", "info",
+        "-i", inputPath,
+        "-map", fmt.Sprintf("0:a:%d", track.StreamIndex),
+        "-vn",
+        "-af", filter,
+        "-f", "null",
+        "-",
+    }
+
+    output, err := runFFmpegCaptureContext(ctx, args)
+    if err != nil {
+        return nil, fmt.Errorf("loudness analysis failed for %s: %w", track.Name, err)
+    }
+    return parseLoudnormOutput(output)
+}
+
+func (p *Processor) normalizationFilter(track AudioTrack, measured *loudnormOutput) string {
+    target := p.loudnessTarget()
+    if measured == nil || !isFiniteLoudness(measured.InputI) || !isFiniteLoudness(measured.InputTP) {
+        return channelLayoutFilter(track)
+    }
+
+    return fmt.Sprintf("%s,loudnorm=I=%.1f:LRA=%.1f:TP=%.1f:"+
+        "measured_I=%s:measured_LRA=%s:measured_TP=%s:measured_thresh=%s:offset=%s:"+
+        "linear=true:print_format=json",
+        channelLayoutFilter(track), target.Integrated, target.LoudnessRange, target.TruePeak,
+        measured.InputI, measured.InputLRA, measured.InputTP, measured.InputThresh, measured.TargetOffset)
+}
+
+func channelLayoutFilter(track AudioTrack) string {
+    layout := "stereo"
+    if track.isSurround() {
+        layout = "5.1"
+    }
+    return fmt.Sprintf("aformat=channel_layouts=%s", layout)
+}
+
+func parseLoudnormOutput(output string) (*loudnormOutput, error) {
+    start := strings.LastIndex(output, "{")
+    end := strings.LastIndex(output, "}")
+    if start < 0 || end < start {
+        return nil, fmt.Errorf("loudnorm statistics not found in ffmpeg output")
+    }
+
+    var result loudnormOutput
+    if err := json.Unmarshal([]byte(output[start:end+1]), &result); err != nil {
+        return nil, fmt.Errorf("failed to parse loudnorm statistics: %v", err)
+    }
+    return &result, nil
+}
+
+func newLoudnessReport(track AudioTrack, target LoudnessTarget, measured, normalized *loudnormOutput) LoudnessReport {
+    report := LoudnessReport{
+        Track:  track.Name,
+        Target: target,
+        Input: LoudnessStats{
+            Integrated:    parseLoudness(measured.InputI),
+            TruePeak:      parseLoudness(measured.InputTP),
+            LoudnessRange: parseLoudness(measured.InputLRA),
+            Threshold:     parseLoudness(measured.InputThresh),
+        },
+        NormalizationType: "none",
+    }
+
+    if normalized != nil {
+        report.Output = LoudnessStats{
+            Integrated:    parseLoudness(normalized.OutputI),
+            TruePeak:      parseLoudness(normalized.OutputTP),
+            LoudnessRange: parseLoudness(normalized.OutputLRA),
+            Threshold:     parseLoudness(normalized.OutputThresh),
+        }
+        report.NormalizationType = normalized.NormalizationType
+    } else {
+        report.Output = report.Input
+    }
+
+    return report
+}
+
+func parseLoudness(value string) float64 {
+    parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+    if err != nil {
+        return math.Inf(-1)
+    }
+    return parsed
+}
+
+func isFiniteLoudness(value string) bool {
+    parsed := parseLoudness(value)
+    return !math.IsInf(parsed, 0) && !math.IsNaN(parsed)
+}
\ No newline at end of file
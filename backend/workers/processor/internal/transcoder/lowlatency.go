@@ -0,0 +1,595 @@
+package transcoder
+
+import (
+    "context"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "math"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "slices"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/pkalsi97/ShortRelay/backend/workers/processor/internal/mp4"
+)
+
+const (
+    DefaultPartDuration = 0.5
+
+    lowLatencyPoll = 100 * time.Millisecond
+
+    // Parts are only advertised for the last few target durations, as
+    // players joining later have no use for them.
+    partWindow = 3
+)
+
+// Publisher makes finished output files available before the final upload.
+type Publisher interface {
+    Publish(path string) error
+}
+
+type llPart struct {
+    URI         string
+    Duration    float64
+    Independent bool
+}
+
+type llSegment struct {
+    Name     string
+    Duration float64
+    Parts    []llPart
+}
+
+// lowLatencyStream splits the fragmented MP4 written by a live encode into
+// the init segment, parts and segments of one media playlist. Each fragment
+// is one part; a segment is closed at the first independent part once it
+// spans the segment time.
+type lowLatencyStream struct {
+    dir            string
+    sourcePath     string
+    source         *os.File
+    segmentTime    float64
+    targetDuration int
+    track          *mp4.Track
+
+    initData []byte
+    pending  []byte
+    fragment []byte
+
+    // partFile is the part the preload hint points at. The fragment ffmpeg
+    // is writing is copied into it as its bytes arrive.
+    partFile  *os.File
+    written   int
+    partCount int
+
+    segmentFile *os.File
+    current     llSegment
+    segments    []llSegment
+}
+
+func (p *Processor) lowLatency() bool {
+    return p.Config.LowLatency != nil
+}
+
+func (p *Processor) partDuration() float64 {
+    if p.Config.LowLatency.PartDuration > 0 {
+        return p.Config.LowLatency.PartDuration
+    }
+    return DefaultPartDuration
+}
+
+func (p *Processor) validateLowLatency() error {
+    if !p.lowLatency() {
+        return nil
+    }
+    if p.Config.Encryption != nil || p.Config.DRM != nil {
+        return fmt.Errorf("low-latency HLS does not support encrypted output")
+    }
+    if p.singleFile() {
+        return fmt.Errorf("low-latency HLS requires the segmented layout")
+    }
+    for _, res := range append(p.Resolutions[:len(p.Resolutions):len(p.Resolutions)], p.VerticalResolutions...) {
+        if len(encodePasses(res, "")) > 1 {
+            return fmt.Errorf("low-latency HLS cannot encode rendition %s in two passes", res.Name)
+        }
+    }
+    segmentTime, _ := strconv.ParseFloat(p.hlsSegmentTime(), 64)
+    if p.partDuration() >= segmentTime {
+        return fmt.Errorf("part duration %.3fs must be shorter than segments of %.3fs", p.partDuration(), segmentTime)
+    }
+    return nil
+}
+
+func (p *Processor) publish(path string) error {
+    if !p.lowLatency() || p.Config.LowLatency.Publisher == nil {
+        return nil
+    }
+    if err := p.Config.LowLatency.Publisher.Publish(path); err != nil {
+        return fmt.Errorf("failed to publish %s: %v", filepath.Base(path), err)
+    }
+    return nil
+}
+
+// publishTree publishes every file under dir.
+func (p *Processor) publishTree(dir string) error {
+    return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+        if err != nil || info.IsDir() {
+            return err
+        }
+        return p.publish(path)
+    })
+}
+
+// generateLowLatency replaces the separate encode and packaging steps. Audio,
+// subtitles and the master go out first, then every rendition is encoded
+// straight into its media playlist so players can join mid-encode.
+func (p *Processor) generateLowLatency() error {
+    if err := p.validateLowLatency(); err != nil {
+        return err
+    }
+
+    // The audio playlists go out with the master, so the tracks are
+    // extracted first.
+    audioJobs, reports := p.audioJobs()
+    if err := p.runJobs(audioJobs); err != nil {
+        return err
+    }
+    p.LoudnessReports = append(p.LoudnessReports, reports...)
+
+    if err := createHLSDirectories(p.Paths, p.Resolutions); err != nil {
+        return err
+    }
+    if err := p.generateSubtitleStreams(); err != nil {
+        return err
+    }
+    if err := p.runJobs(p.audioStreamJobs()); err != nil {
+        return err
+    }
+    if err := p.generateMasterPlaylist(); err != nil {
+        return err
+    }
+    if err := p.publishTree(p.Paths.HLSDir); err != nil {
+        return err
+    }
+
+    renditions := append(p.Resolutions[:len(p.Resolutions):len(p.Resolutions)], p.VerticalResolutions...)
+    shares := threadShares(renditions, p.threadBudget())
+    var jobs []Job
+    budget := 0
+    for i, res := range renditions {
+        res := res
+        inputs, filter := p.renditionFilter(res)
+        mp4Path := filepath.Join(p.Paths.MP4Dir, fmt.Sprintf("%s.mp4", res.Name))
+        streamDir := filepath.Join(p.Paths.HLSDir, "video", res.Name)
+        name := res.Name
+        if i >= len(p.Resolutions) {
+            inputs, filter = p.verticalFilter(res)
+            mp4Path, streamDir = p.verticalMP4(res), p.verticalStreamDir(res)
+            name = "vertical " + res.Name
+        }
+
+        budget += shares[i]
+        jobs = append(jobs, Job{
+            Name:    name,
+            Threads: shares[i],
+            Run: func(ctx context.Context, threads int) error {
+                return p.generateLiveStream(ctx, res, inputs, filter, mp4Path, streamDir, threads)
+            },
+        })
+    }
+
+    // A rendition left queued would not be live, so the budget is sized to
+    // run the whole ladder at once.
+    return NewScheduler(budget).Run(context.Background(), fatalJobs(jobs))
+}
+
+// generateLiveStream encodes one rendition into a fragmented MP4 that is cut
+// into parts while ffmpeg writes it. The rendition's MP4 is remuxed from the
+// same encode once it finishes.
+func (p *Processor) generateLiveStream(ctx context.Context, res Resolution, inputs, filter []string, mp4Path, streamDir string, threads int) error {
+    if err := os.MkdirAll(streamDir, 0755); err != nil {
+        return fmt.Errorf("failed to create video directory: %v", err)
+    }
+    source := strings.TrimSuffix(mp4Path, ".mp4") + "_live.mp4"
+
+    args := append([]string{
+        "-v", "error",
+        "-i", p.InputPath,
+    }, inputs...)
+    args = append(args, filter...)
+    if !slices.Contains(filter, "-map") {
+        args = append(args, "-map", "0:v:0")
+    }
+    // Audio is carried only by the demuxed audio playlists, as in VOD.
+    args = append(args, "-an")
+    args = append(args, p.videoCodecArgs(res, p.ladderKeyframeArgs(), threads)...)
+
+    // Fragments start on every keyframe and are cut at the part duration
+    // (in microseconds), and each is flushed as soon as it is complete.
+    args = append(args,
+        "-f", "mp4",
+        "-movflags", "+frag_keyframe+empty_moov+default_base_moof",
+        "-frag_duration", fmt.Sprintf("%d", int(p.partDuration()*1e6)),
+        "-flush_packets", "1",
+        "-y",
+        source)
+
+    cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+    cmd.Stdout = os.Stdout
+    cmd.Stderr = os.Stderr
+    segmentTime, _ := strconv.ParseFloat(p.hlsSegmentTime(), 64)
+    stream := &lowLatencyStream{
+        dir:            streamDir,
+        sourcePath:     source,
+        segmentTime:    segmentTime,
+        targetDuration: int(math.Ceil(segmentTime)),
+    }
+    if err := p.runLowLatency(cmd, stream); err != nil {
+        return fmt.Errorf("live rendition %s failed: %w", res.Name, commandError(ctx, err))
+    }
+
+    err := runFFmpeg([]string{
+        "-v", "error",
+        "-i", source,
+        "-map", "0:v:0",
+        "-c", "copy",
+        "-movflags", "+faststart+rtphint",
+        "-y",
+        mp4Path,
+    })
+    if err != nil {
+        return fmt.Errorf("failed to remux live rendition %s: %v", res.Name, err)
+    }
+    return os.Remove(source)
+}
+
+// runLowLatency follows the encode's output while ffmpeg runs, and closes
+// the stream once it exits.
+func (p *Processor) runLowLatency(cmd *exec.Cmd, stream *lowLatencyStream) error {
+    if err := cmd.Start(); err != nil {
+        return err
+    }
+    done := make(chan error, 1)
+    go func() {
+        done <- cmd.Wait()
+    }()
+    defer stream.close()
+
+    ticker := time.NewTicker(lowLatencyPoll)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case err := <-done:
+            if err != nil {
+                return err
+            }
+            if err := p.readLowLatency(stream, true); err != nil {
+                return err
+            }
+            return p.finishLowLatency(stream)
+        case <-ticker.C:
+            if err := p.readLowLatency(stream, false); err != nil {
+                cmd.Process.Kill()
+                <-done
+                return err
+            }
+        }
+    }
+}
+
+// readLowLatency sorts the bytes ffmpeg has written since the last poll into
+// boxes. Only whole boxes are parsed; the tail of the fragment still being
+// written goes into the hinted part file as is.
+func (p *Processor) readLowLatency(stream *lowLatencyStream, final bool) error {
+    if stream.source == nil {
+        source, err := os.Open(stream.sourcePath)
+        if os.IsNotExist(err) && !final {
+            return nil
+        }
+        if err != nil {
+            return fmt.Errorf("failed to open live encode: %v", err)
+        }
+        stream.source = source
+    }
+
+    data, err := io.ReadAll(stream.source)
+    if err != nil {
+        return fmt.Errorf("failed to read live encode: %v", err)
+    }
+    stream.pending = append(stream.pending, data...)
+
+    for {
+        boxType, size, ok := completeBox(stream.pending)
+        if !ok {
+            break
+        }
+        box := stream.pending[:size]
+        stream.pending = stream.pending[size:]
+
+        // Boxes between fragments, such as mfra, are not part of any part.
+        switch {
+        case stream.track == nil:
+            stream.initData = append(stream.initData, box...)
+            if boxType == "moov" {
+                if err := p.finishInit(stream); err != nil {
+                    return err
+                }
+            }
+        case boxType == "moof" || len(stream.fragment) > 0:
+            stream.fragment = append(stream.fragment, box...)
+            if boxType == "mdat" {
+                if err := p.finishPart(stream); err != nil {
+                    return err
+                }
+            }
+        }
+    }
+
+    if final && (len(stream.pending) > 0 || len(stream.fragment) > 0) {
+        return fmt.Errorf("live encode ended inside a fragment")
+    }
+    if stream.partFile != nil && (len(stream.fragment) > 0 || boxTypeOf(stream.pending) == "moof") {
+        return stream.fillPart(append(stream.fragment[:len(stream.fragment):len(stream.fragment)], stream.pending...))
+    }
+    return nil
+}
+
+func (p *Processor) finishInit(stream *lowLatencyStream) error {
+    tracks, err := mp4.ReadTracks(stream.initData)
+    if err != nil {
+        return fmt.Errorf("failed to parse init segment: %v", err)
+    }
+    track, ok := videoTrack(tracks)
+    if !ok || track.Timescale == 0 {
+        return fmt.Errorf("no video track in %s", stream.dir)
+    }
+    stream.track = &track
+
+    init := filepath.Join(stream.dir, "init.mp4")
+    if err := os.WriteFile(init, stream.initData, 0644); err != nil {
+        return fmt.Errorf("failed to write init segment: %v", err)
+    }
+    if err := p.publish(init); err != nil {
+        return err
+    }
+    return stream.openPart()
+}
+
+// finishPart publishes a completed fragment as a part, appends it to its
+// segment and moves the preload hint on to the next part.
+func (p *Processor) finishPart(stream *lowLatencyStream) error {
+    part, err := readPart(stream.fragment, *stream.track)
+    if err != nil {
+        return fmt.Errorf("failed to parse fragment: %v", err)
+    }
+    if part.Independent && stream.current.Duration >= stream.segmentTime-1e-3 {
+        if err := p.finishSegment(stream); err != nil {
+            return err
+        }
+    }
+
+    if stream.segmentFile == nil {
+        stream.current = llSegment{Name: fmt.Sprintf("data%03d.m4s", len(stream.segments))}
+        segmentFile, err := os.Create(filepath.Join(stream.dir, stream.current.Name))
+        if err != nil {
+            return fmt.Errorf("failed to create segment: %v", err)
+        }
+        stream.segmentFile = segmentFile
+    }
+    if _, err := stream.segmentFile.Write(stream.fragment); err != nil {
+        return fmt.Errorf("failed to write segment %s: %v", stream.current.Name, err)
+    }
+
+    if err := stream.fillPart(stream.fragment); err != nil {
+        return err
+    }
+    partPath := stream.partFile.Name()
+    if err := stream.partFile.Close(); err != nil {
+        return fmt.Errorf("failed to write part: %v", err)
+    }
+    stream.partFile = nil
+    if err := p.publish(partPath); err != nil {
+        return err
+    }
+
+    part.URI = filepath.Base(partPath)
+    stream.current.Parts = append(stream.current.Parts, part)
+    stream.current.Duration += part.Duration
+    stream.fragment = nil
+
+    if err := stream.openPart(); err != nil {
+        return err
+    }
+    return p.writeLowLatencyPlaylist(stream, false)
+}
+
+func (p *Processor) finishSegment(stream *lowLatencyStream) error {
+    if stream.segmentFile == nil {
+        return nil
+    }
+    segmentPath := stream.segmentFile.Name()
+    if err := stream.segmentFile.Close(); err != nil {
+        return fmt.Errorf("failed to write segment %s: %v", stream.current.Name, err)
+    }
+    stream.segmentFile = nil
+    if err := p.publish(segmentPath); err != nil {
+        return err
+    }
+
+    stream.current.Duration = math.Round(stream.current.Duration*1e5) / 1e5
+    if rounded := int(math.Round(stream.current.Duration)); rounded > stream.targetDuration {
+        stream.targetDuration = rounded
+    }
+    stream.segments = append(stream.segments, stream.current)
+    stream.current = llSegment{}
+    return nil
+}
+
+// finishLowLatency closes the last segment and ends the playlist. The part
+// the hint pointed at never received a fragment, so it is removed.
+func (p *Processor) finishLowLatency(stream *lowLatencyStream) error {
+    if stream.partFile != nil {
+        hinted := stream.partFile.Name()
+        stream.partFile.Close()
+        stream.partFile = nil
+        if err := os.Remove(hinted); err != nil {
+            return err
+        }
+    }
+    if err := p.finishSegment(stream); err != nil {
+        return err
+    }
+    if len(stream.segments) == 0 {
+        return fmt.Errorf("live encode produced no segments")
+    }
+    return p.writeLowLatencyPlaylist(stream, true)
+}
+
+func (p *Processor) writeLowLatencyPlaylist(stream *lowLatencyStream, final bool) error {
+    playlist := filepath.Join(stream.dir, "stream.m3u8")
+    if err := os.WriteFile(playlist, []byte(p.lowLatencyPlaylistContent(stream, final)), 0644); err != nil {
+        return err
+    }
+    return p.publish(playlist)
+}
+
+func (p *Processor) lowLatencyPlaylistContent(stream *lowLatencyStream, final bool) string {
+    partTarget := p.partDuration()
+    playlist := []string{
+        "#EXTM3U",
+        "#EXT-X-VERSION:9",
+        fmt.Sprintf("#EXT-X-TARGETDURATION:%d", stream.targetDuration),
+        fmt.Sprintf("#EXT-X-PART-INF:PART-TARGET=%.3f", partTarget),
+        fmt.Sprintf("#EXT-X-SERVER-CONTROL:PART-HOLD-BACK=%.3f", partTarget*partWindow),
+        "#EXT-X-PLAYLIST-TYPE:EVENT",
+        "#EXT-X-MEDIA-SEQUENCE:0",
+        "#EXT-X-INDEPENDENT-SEGMENTS",
+        "#EXT-X-MAP:URI=\"init.mp4\"",
+    }
+
+    // Once the stream has ended parts are dropped, which leaves a plain
+    // event playlist for on-demand viewing.
+    window := float64(stream.targetDuration * partWindow)
+    remaining := stream.current.Duration
+    for _, segment := range stream.segments {
+        remaining += segment.Duration
+    }
+    for _, segment := range stream.segments {
+        if !final && remaining <= window {
+            playlist = append(playlist, partLines(segment.Parts)...)
+        }
+        remaining -= segment.Duration
+        playlist = append(playlist, fmt.Sprintf("#EXTINF:%.5f,", segment.Duration), segment.Name)
+    }
+
+    if final {
+        playlist = append(playlist, "#EXT-X-ENDLIST")
+    } else {
+        playlist = append(playlist, partLines(stream.current.Parts)...)
+        if stream.partFile != nil {
+            playlist = append(playlist, fmt.Sprintf("#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"%s\"", filepath.Base(stream.partFile.Name())))
+        }
+    }
+    return strings.Join(playlist, "\n") + "\n"
+}
+
+func partLines(parts []llPart) []string {
+    var lines []string
+    for _, part := range parts {
+        line := fmt.Sprintf("#EXT-X-PART:DURATION=%.5f,URI=\"%s\"", part.Duration, part.URI)
+        if part.Independent {
+            line += ",INDEPENDENT=YES"
+        }
+        lines = append(lines, line)
+    }
+    return lines
+}
+
+// openPart creates the file for the next part up front, so the preload hint
+// names a file that is being written.
+func (s *lowLatencyStream) openPart() error {
+    partFile, err := os.Create(filepath.Join(s.dir, fmt.Sprintf("part%05d.m4s", s.partCount)))
+    if err != nil {
+        return fmt.Errorf("failed to create part: %v", err)
+    }
+    s.partCount++
+    s.partFile = partFile
+    s.written = 0
+    return nil
+}
+
+// fillPart appends the bytes of the fragment not yet in the part file.
+func (s *lowLatencyStream) fillPart(fragment []byte) error {
+    if len(fragment) <= s.written {
+        return nil
+    }
+    if _, err := s.partFile.Write(fragment[s.written:]); err != nil {
+        return fmt.Errorf("failed to write part: %v", err)
+    }
+    s.written = len(fragment)
+    return nil
+}
+
+func (s *lowLatencyStream) close() {
+    for _, file := range []*os.File{s.source, s.partFile, s.segmentFile} {
+        if file != nil {
+            file.Close()
+        }
+    }
+}
+
+// readPart describes one moof/mdat fragment. The encoder cuts fragments at
+// the part duration, so no further grouping is needed.
+func readPart(fragment []byte, track mp4.Track) (llPart, error) {
+    samples, err := mp4.ReadSamples(fragment, track)
+    if err != nil {
+        return llPart{}, err
+    }
+    var part llPart
+    for i, sample := range samples {
+        if i == 0 {
+            part.Independent = sample.Sync
+        }
+        part.Duration += float64(sample.Duration) / float64(track.Timescale)
+    }
+    part.Duration = math.Round(part.Duration*1e5) / 1e5
+    return part, nil
+}
+
+// completeBox reports the type and size of the box at the start of data
+// once all of it has been written.
+func completeBox(data []byte) (string, int, bool) {
+    boxType := boxTypeOf(data)
+    if boxType == "" {
+        return "", 0, false
+    }
+    size := uint64(binary.BigEndian.Uint32(data))
+    header := uint64(8)
+    switch size {
+    case 0:
+        // A box running to the end of the file is only complete at exit,
+        // and ffmpeg does not write one for fragmented output.
+        return "", 0, false
+    case 1:
+        if len(data) < 16 {
+            return "", 0, false
+        }
+        size, header = binary.BigEndian.Uint64(data[8:]), 16
+    }
+    if size < header || size > uint64(len(data)) {
+        return "", 0, false
+    }
+    return boxType, int(size), true
+}
+
+func boxTypeOf(data []byte) string {
+    if len(data) < 8 {
+        return ""
+    }
+    return string(data[4:8])
+}
\ No newline at end of file
@@ -0,0 +1,85 @@
+package transcoder
+
+import (
+    "encoding/binary"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "github.com/pkalsi97/ShortRelay/backend/workers/processor/internal/mp4"
+)
+
+func box(boxType string, size int) []byte {
+    data := make([]byte, size)
+    binary.BigEndian.PutUint32(data, uint32(size))
+    copy(data[4:], boxType)
+    return data
+}
+
+func TestCompleteBox(t *testing.T) {
+    large := make([]byte, 24)
+    binary.BigEndian.PutUint32(large, 1)
+    copy(large[4:], "mdat")
+    binary.BigEndian.PutUint64(large[8:], 24)
+    toEnd := box("mdat", 16)
+    binary.BigEndian.PutUint32(toEnd, 0)
+
+    tests := []struct {
+        name     string
+        data     []byte
+        complete bool
+        size     int
+    }{
+        {name: "partial header", data: box("moof", 32)[:6]},
+        {name: "partial body", data: box("moof", 32)[:20]},
+        {name: "whole box", data: box("moof", 32), complete: true, size: 32},
+        {name: "followed by the next box", data: append(box("moof", 32), box("mdat", 16)[:10]...), complete: true, size: 32},
+        {name: "large size", data: large, complete: true, size: 24},
+        {name: "large size cut short", data: large[:20]},
+        {name: "runs to end of file", data: toEnd},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            _, size, complete := completeBox(test.data)
+            if complete != test.complete || size != test.size {
+                t.Errorf("completeBox = %d, %v; want %d, %v", size, complete, test.size, test.complete)
+            }
+        })
+    }
+}
+
+func TestReadLowLatencyFillsHintedPart(t *testing.T) {
+    dir := t.TempDir()
+    source := filepath.Join(dir, "live.mp4")
+    p := &Processor{Config: &ProcessorConfig{LowLatency: &LowLatencyConfig{}}}
+    stream := &lowLatencyStream{dir: dir, sourcePath: source, targetDuration: 2, track: &mp4.Track{Timescale: 90000}}
+    if err := stream.openPart(); err != nil {
+        t.Fatal(err)
+    }
+    defer stream.close()
+
+    // ffmpeg has written the start of a fragment but not all of its moof.
+    if err := os.WriteFile(source, box("moof", 64)[:40], 0644); err != nil {
+        t.Fatal(err)
+    }
+    if err := p.readLowLatency(stream, false); err != nil {
+        t.Fatal(err)
+    }
+
+    written, err := os.ReadFile(filepath.Join(dir, "part00000.m4s"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(written) != 40 {
+        t.Errorf("hinted part holds %d bytes, want 40", len(written))
+    }
+    playlist := p.lowLatencyPlaylistContent(stream, false)
+    if !strings.Contains(playlist, `#EXT-X-PRELOAD-HINT:TYPE=PART,URI="part00000.m4s"`) {
+        t.Errorf("playlist does not hint the part being written:\n%s", playlist)
+    }
+    if strings.Contains(playlist, "#EXT-X-PART:") {
+        t.Errorf("playlist lists an unfinished part:\n%s", playlist)
+    }
+}
\ No newline at end of file
@@ -1,10 +1,16 @@
 package transcoder
 
+import (
+    "github.com/pkalsi97/ShortRelay/backend/workers/processor/internal/encryption"
+)
+
 type Resolution struct {
-    Name    string
-    Width   int
-    Height  int
-    Bitrate string
+    Name        string `yaml:"name"`
+    Width       int    `yaml:"width"`
+    Height      int    `yaml:"height"`
+    Bitrate     string `yaml:"bitrate"`
+    RateControl string `yaml:"rateControl"`
+    CRF         int    `yaml:"crf"`
 }
 
 type OutputPaths struct {
@@ -13,19 +19,196 @@ type OutputPaths struct {
     HLSDir     string
     AssetsDir  string
     LogsDir    string
+    KeysDir    string
+}
+
+type AudioStream struct {
+    Index        int
+    Codec        string
+    Channels     int
+    Language     string
+    Title        string
+    IsDefault    bool
+    IsCommentary bool
+}
+
+type AudioTrack struct {
+    Name        string
+    StreamIndex int
+    Language    string
+    Title       string
+    Codec       string
+    Bitrate     string
+    SampleRate  int
+    Channels    int
+    Default     bool
+    AutoSelect  bool
+    MP4File     string
+    PlaylistDir string
+}
+
+type SubtitleStream struct {
+    Index           int
+    Codec           string
+    Language        string
+    Title           string
+    IsDefault       bool
+    IsForced        bool
+    IsClosedCaption bool
+}
+
+type SubtitleTrack struct {
+    Name        string
+    Source      SubtitleStream
+    Language    string
+    Title       string
+    Default     bool
+    Forced      bool
+    Sidecar     bool
+    VTTFile     string
+    PlaylistDir string
+}
+
+type SidecarSubtitle struct {
+    Path     string
+    Language string
+    Label    string
+    Offset   float64
+}
+
+type AudioRules struct {
+    DefaultLanguages    []string
+    AutoSelectLanguages []string
+}
+
+type SurroundConfig struct {
+    Disabled bool
+    Codec    string
+    Bitrate  string
+}
+
+type LoudnessTarget struct {
+    Integrated    float64
+    LoudnessRange float64
+    TruePeak      float64
+}
+
+type LoudnessStats struct {
+    Integrated    float64
+    TruePeak      float64
+    LoudnessRange float64
+    Threshold     float64
+}
+
+type LoudnessReport struct {
+    Track             string
+    Target            LoudnessTarget
+    Input             LoudnessStats
+    Output            LoudnessStats
+    NormalizationType string
+}
+
+type EncryptionConfig struct {
+    Method         string
+    KeyURLTemplate string
+    WrappingKey    []byte
+    KeyStore       encryption.KeyStore
+    UserID         string
+    AssetID        string
+}
+
+type DRMConfig struct {
+    Scheme   string
+    Provider encryption.KeyProvider
+    AssetID  string
+}
+
+type Watermark struct {
+    ImagePath string
+    Position  string
+    Margin    float64
+    Opacity   float64
+    Scale     float64
+    Start     float64
+    End       float64
+}
+
+type LowLatencyConfig struct {
+    PartDuration float64
+    Publisher    Publisher
+}
+
+type ChunkConfig struct {
+    Count       int
+    MinDuration float64
+    Queue       ChunkQueue
+}
+
+type TimeRange struct {
+    Start float64
+    End   float64
+}
+
+type ProcessorConfig struct {
+    AudioRules    AudioRules
+    SurroundAudio SurroundConfig
+    Loudness      LoudnessTarget
+    Encryption    *EncryptionConfig
+    DRM           *DRMConfig
+    Watermark     *Watermark
+    Trim          []TimeRange
+    Crop          string
+    FrameRate     float64
+    Deinterlacer  string
+    Vertical      string
+    Scenes        *SceneConfig
+    QualityGate   *QualityGateConfig
+    HLSLayout     string
+    LowLatency    *LowLatencyConfig
+    EncodeMode    string
+    ThreadBudget  int
+
+    SingleDecodeMinCPUs int
+    Chunking      *ChunkConfig
+    Profile       *Profile
 }
 
 type VideoInfo struct {
-    Width      int
-    Height     int
-    Duration   float64
-    HasAudio   bool
-    IsVertical bool
+    Width        int
+    Height       int
+    Duration     float64
+    HasAudio     bool
+    IsVertical   bool
+    AudioStreams []AudioStream
+    FrameRate    float64
+    AvgFrameRate float64
+    FieldOrder   string
+
+    SubtitleStreams []SubtitleStream
 }
 
 type Processor struct {
     InputPath   string
+    SourcePath  string
     Paths       *OutputPaths
     Resolutions []Resolution
     VideoInfo   *VideoInfo
+    Config      *ProcessorConfig
+    AudioTracks []AudioTrack
+
+    SubtitleTracks      []SubtitleTrack
+    VerticalResolutions []Resolution
+
+    LoudnessReports []LoudnessReport
+    ContentKey      *encryption.ContentKey
+    DRMKeys         *encryption.KeySet
+    TrimRanges      []TimeRange
+    Crop            *CropRect
+    CropSource      string
+    Cadence         FrameCadence
+    Chapters        []Chapter
+
+    keyURI           string
+    verticalCropX    string
+    iframeBandwidths map[string]int
 }
\ No newline at end of file
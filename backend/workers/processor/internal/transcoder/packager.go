@@ -0,0 +1,138 @@
+package transcoder
+
+import (
+    "fmt"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "strings"
+)
+
+const packagerMasterPlaylist = "packager.m3u8"
+
+type packagerStream struct {
+    Input        string
+    Stream       string
+    Dir          string
+    SegmentName  string
+    PlaylistName string
+    GroupID      string
+    Name         string
+    Language     string
+    DRMLabel     string
+    SingleFile   bool
+}
+
+func (s packagerStream) descriptor() string {
+    segmentName := s.SegmentName
+    if segmentName == "" {
+        segmentName = "data"
+    }
+    playlistName := s.PlaylistName
+    if playlistName == "" {
+        playlistName = "stream.m3u8"
+    }
+
+    fields := []string{
+        "in=" + s.Input,
+        "stream=" + s.Stream,
+    }
+    if s.SingleFile {
+        // Without a segment template the packager writes one file and
+        // addresses the init segment and fragments by byte range.
+        fields = append(fields, "output="+filepath.ToSlash(filepath.Join(s.Dir, singleFileSegment)))
+    } else {
+        fields = append(fields,
+            "init_segment="+filepath.ToSlash(filepath.Join(s.Dir, "init.mp4")),
+            "segment_template="+filepath.ToSlash(filepath.Join(s.Dir, segmentName+"$Number%03d$.m4s")))
+    }
+    fields = append(fields, "playlist_name="+filepath.ToSlash(filepath.Join(s.Dir, playlistName)))
+    if s.GroupID != "" {
+        fields = append(fields, "hls_group_id="+s.GroupID)
+    }
+    if s.Name != "" {
+        fields = append(fields, "hls_name="+strings.ReplaceAll(s.Name, ",", " "))
+    }
+    if s.Language != "" && s.Language != undeterminedLanguage {
+        fields = append(fields, "language="+s.Language)
+    }
+    if s.DRMLabel != "" {
+        fields = append(fields, "drm_label="+s.DRMLabel)
+    }
+    return strings.Join(fields, ",")
+}
+
+// runPackager packages streams relative to the HLS directory. The packager
+// insists on writing a master playlist; ours is generated separately, so its
+// copy is discarded.
+func (p *Processor) runPackager(streams []packagerStream, extraArgs []string) error {
+    args := make([]string, 0, len(streams)+len(extraArgs)+8)
+    for _, stream := range streams {
+        args = append(args, stream.descriptor())
+    }
+    args = append(args,
+        "--segment_duration", p.segmentDuration(),
+        "--hls_playlist_type", "VOD",
+        "--hls_master_playlist_output", packagerMasterPlaylist)
+    args = append(args, extraArgs...)
+
+    cmd := exec.Command("packager", args...)
+    cmd.Dir = p.Paths.HLSDir
+    cmd.Stdout = os.Stdout
+    cmd.Stderr = os.Stderr
+    if err := cmd.Run(); err != nil {
+        return fmt.Errorf("packager failed: %v", err)
+    }
+
+    return os.Remove(filepath.Join(p.Paths.HLSDir, packagerMasterPlaylist))
+}
+
+// packageProtected writes the video and audio renditions through the packager
+// with sample-level encryption. DRM output also gets a DASH manifest next to
+// the HLS master, sharing the same CMAF segments.
+func (p *Processor) packageProtected() error {
+    var streams []packagerStream
+    for _, res := range p.Resolutions {
+        streams = append(streams, packagerStream{
+            Input:      filepath.Join(p.Paths.MP4Dir, fmt.Sprintf("%s.mp4", res.Name)),
+            Stream:     "video",
+            Dir:        filepath.Join("video", res.Name),
+            DRMLabel:   p.drmLabel(drmLabelVideo),
+            SingleFile: p.singleFile(),
+        })
+    }
+    for _, res := range p.VerticalResolutions {
+        streams = append(streams, packagerStream{
+            Input:      p.verticalMP4(res),
+            Stream:     "video",
+            Dir:        filepath.Join(verticalDir, "video", res.Name),
+            DRMLabel:   p.drmLabel(drmLabelVideo),
+            SingleFile: p.singleFile(),
+        })
+    }
+    for _, track := range p.AudioTracks {
+        streams = append(streams, packagerStream{
+            Input:      filepath.Join(p.Paths.MP4Dir, track.MP4File),
+            Stream:     "audio",
+            Dir:        track.PlaylistDir,
+            GroupID:    stereoAudioGroup,
+            Name:       track.Title,
+            Language:   track.Language,
+            DRMLabel:   p.drmLabel(drmLabelAudio),
+            SingleFile: p.singleFile(),
+        })
+    }
+
+    args := p.packagerProtectionArgs()
+    if p.DRMKeys != nil {
+        args = append(args, "--mpd_output", "manifest.mpd")
+    }
+    return p.runPackager(streams, args)
+}
+
+func (p *Processor) drmLabel(label string) string {
+    if p.DRMKeys == nil {
+        return ""
+    }
+    return label
+}
\ No newline at end of file
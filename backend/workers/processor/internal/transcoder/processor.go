@@ -1,6 +1,7 @@
 package transcoder
 
 import (
+    "context"
     "fmt"
     "os"
     "log"
@@ -9,17 +10,21 @@ import (
     "strings"
 )
  
-func NewProcessor(inputPath string, resolutions []Resolution) (*Processor, error) {
-    dir := filepath.Dir(inputPath)    
-    outputDir := filepath.Join(dir, "transcoded")
-    paths := &OutputPaths{
-        BaseDir:    outputDir,
-        MP4Dir:     filepath.Join(outputDir, "mp4"),
-        HLSDir:     filepath.Join(outputDir, "hls"),
-        AssetsDir:  filepath.Join(outputDir, "assets"),
-        LogsDir:    filepath.Join(outputDir, "logs"),
+func NewProcessor(inputPath string, resolutions []Resolution, config *ProcessorConfig) (*Processor, error) {
+    if config == nil {
+        config = &ProcessorConfig{}
+    }
+    if config.Profile == nil {
+        profile := DefaultProfile()
+        config.Profile = &profile
+    }
+    for _, res := range resolutions {
+        if err := validateRateControl(res); err != nil {
+            return nil, err
+        }
     }
 
+    paths := newOutputPaths(filepath.Dir(inputPath))
     if err := createDirectories(paths); err != nil {
         return nil, err
     }
@@ -29,23 +34,60 @@ func NewProcessor(inputPath string, resolutions []Resolution) (*Processor, error
         return nil, err
     }
 
-    return &Processor{
+    processor := &Processor{
         InputPath:   inputPath,
+        SourcePath:  inputPath,
         Paths:       paths,
         Resolutions: resolutions,
         VideoInfo:   videoInfo,
-    }, nil
+        Config:      config,
+        AudioTracks: buildAudioTracks(videoInfo.AudioStreams, config.AudioRules, config.SurroundAudio, config.Profile.Audio),
+
+        SubtitleTracks: buildSubtitleTracks(videoInfo.SubtitleStreams),
+    }
+
+    if err := processor.applyTrim(); err != nil {
+        return nil, err
+    }
+    if err := processor.applyCrop(); err != nil {
+        return nil, err
+    }
+    if err := processor.analyzeCadence(); err != nil {
+        return nil, err
+    }
+    if err := processor.prepareVertical(); err != nil {
+        return nil, err
+    }
+    if err := processor.detectScenes(); err != nil {
+        log.Printf("Continuing without chapters: %v", err)
+    }
+
+    return processor, nil
+}
+
+// newOutputPaths lays out the outputs of the asset whose work directory is
+// dir.
+func newOutputPaths(dir string) *OutputPaths {
+    outputDir := filepath.Join(dir, "transcoded")
+    return &OutputPaths{
+        BaseDir:    outputDir,
+        MP4Dir:     filepath.Join(outputDir, "mp4"),
+        HLSDir:     filepath.Join(outputDir, "hls"),
+        AssetsDir:  filepath.Join(outputDir, "assets"),
+        LogsDir:    filepath.Join(outputDir, "logs"),
+        KeysDir:    filepath.Join(dir, "keys"),
+    }
 }
 
 func (p *Processor) GenerateThumbnail() error {    
     args := []string{
         "-v", "error",
         "-y",
-        "-ss", fmt.Sprintf("%.2f", p.VideoInfo.Duration/2),
+        "-ss", fmt.Sprintf("%.2f", p.thumbnailTime()),
         "-i", p.InputPath,
         "-frames:v", "1",
         "-f", "image2",
-        "-vf", "scale=w='min(1920,iw)':h='min(1080,ih)':force_original_aspect_ratio=decrease",
+        "-vf", p.cadenceFilter() + p.cropFilter() + p.thumbnailScale(),
         "-update", "1",
         filepath.Join(p.Paths.AssetsDir, "thumbnail.png"),
     }
@@ -58,85 +100,251 @@ func (p *Processor) GenerateThumbnail() error {
         return fmt.Errorf("thumbnail generation failed: %v", err)
     }
 
+    if len(p.Chapters) == 0 {
+        return nil
+    }
+    if err := p.writeChapters(); err != nil {
+        return err
+    }
+    if err := p.generatePreview(); err != nil {
+        log.Printf("Preview generation failed: %v", err)
+    }
+
     return nil
 }
 
 func (p *Processor) GenerateMP4Files() error {
-    if p.VideoInfo.HasAudio {
-        if err := p.extractAudio(p.InputPath); err != nil {
-            return err
-        }
+    // Embedded subtitles are not carried into the trimmed intermediate, so
+    // they are read from the source and moved onto the trimmed timeline.
+    p.extractSubtitles(p.SourcePath)
+    p.prepareSmartCrop()
+    if err := p.writeManifest(); err != nil {
+        return err
     }
 
-    for _, res := range p.Resolutions {
-        if err := p.generateMP4(p.InputPath, res); err != nil {
-            return err
+    if p.lowLatency() {
+        return p.generateLowLatency()
+    }
+
+    // The heaviest encodes are queued first, as they bound the stage's
+    // wall time.
+    var jobs []Job
+    if count := p.chunkCount(); count > 0 {
+        jobs = append(jobs, Job{
+            Name:    "chunked ladder",
+            Threads: p.threadBudget(),
+            Run: func(ctx context.Context, threads int) error {
+                return p.generateChunkedMP4(ctx, count, threads)
+            },
+        })
+    } else if p.EncodeMode() == EncodeModeSingleDecode {
+        jobs = append(jobs, Job{
+            Name:    "ladder",
+            Threads: p.threadBudget(),
+            Run: func(ctx context.Context, threads int) error {
+                return p.generateMP4Ladder(ctx, p.InputPath, threads)
+            },
+        })
+    } else {
+        shares := threadShares(p.Resolutions, p.threadBudget())
+        for i, res := range p.Resolutions {
+            res := res
+            jobs = append(jobs, Job{
+                Name:    res.Name,
+                Threads: shares[i],
+                Run: func(ctx context.Context, threads int) error {
+                    return p.generateMP4(ctx, p.InputPath, res, threads)
+                },
+            })
         }
     }
 
+    verticalShares := threadShares(p.VerticalResolutions, p.threadBudget())
+    for i, res := range p.VerticalResolutions {
+        res := res
+        jobs = append(jobs, Job{
+            Name:    "vertical " + res.Name,
+            Threads: verticalShares[i],
+            Run: func(ctx context.Context, threads int) error {
+                return p.generateVerticalMP4(ctx, p.InputPath, res, threads)
+            },
+        })
+    }
+
+    audioJobs, reports := p.audioJobs()
+    jobs = append(jobs, audioJobs...)
+
+    if err := p.runJobs(jobs); err != nil {
+        return err
+    }
+    p.LoudnessReports = append(p.LoudnessReports, reports...)
     return nil
 }
 
-func (p *Processor) extractAudio(inputPath string) error {
+// A subtitle stream that cannot be converted is dropped rather than failing
+// the whole asset, since the video and audio are still publishable.
+func (p *Processor) extractSubtitles(inputPath string) {
+    extracted := p.SubtitleTracks[:0]
+    for _, track := range p.SubtitleTracks {
+        if track.Sidecar {
+            extracted = append(extracted, track)
+            continue
+        }
+        if err := p.extractSubtitle(inputPath, track); err != nil {
+            log.Printf("Skipping subtitle track %s: %v", track.Name, err)
+            continue
+        }
+        if err := p.trimSubtitleFile(filepath.Join(p.Paths.MP4Dir, track.VTTFile)); err != nil {
+            log.Printf("Skipping subtitle track %s: %v", track.Name, err)
+            continue
+        }
+        extracted = append(extracted, track)
+    }
+    p.SubtitleTracks = extracted
+}
+
+func (p *Processor) extractSubtitle(inputPath string, track SubtitleTrack) error {
+    args := []string{"-v", "error"}
+
+    if track.Source.IsClosedCaption {
+        args = append(args,
+            "-f", "lavfi",
+            "-i", fmt.Sprintf("movie=%s[out0+subcc]", escapeFilterPath(inputPath)),
+            "-map", "0:s:0")
+    } else {
+        args = append(args,
+            "-i", inputPath,
+            "-map", fmt.Sprintf("0:s:%d", track.Source.Index))
+    }
+
+    args = append(args,
+        "-c:s", "webvtt",
+        "-f", "webvtt",
+        "-y",
+        filepath.Join(p.Paths.MP4Dir, track.VTTFile))
+
+    return runFFmpeg(args)
+}
+
+func (p *Processor) extractAudio(ctx context.Context, inputPath string, track AudioTrack) (LoudnessReport, error) {
+    measured, err := p.measureLoudness(ctx, inputPath, track)
+    if err != nil {
+        return LoudnessReport{}, err
+    }
+    filter := p.normalizationFilter(track, measured)
+
     args := []string{
-        "-v", "error",
+        "-hide_banner",
+        "-nostats",
+        "-v", "info",
         "-i", inputPath,
+        "-map", fmt.Sprintf("0:a:%d", track.StreamIndex),
         "-vn",
-        "-c:a", "aac",
-        "-b:a", "128k",
-        "-ar", "44100",
-        "-ac", "2",
-        "-af", "loudnorm=I=-16:LRA=11:TP=-1.5",
+        "-c:a", track.Codec,
+        "-b:a", track.Bitrate,
+        "-ar", fmt.Sprintf("%d", track.SampleRate),
+        "-ac", fmt.Sprintf("%d", track.Channels),
+        "-af", filter,
         "-metadata", "encoded_by=ShortRelay",
+        "-metadata:s:a:0", fmt.Sprintf("language=%s", track.Language),
+        "-metadata:s:a:0", fmt.Sprintf("title=%s", track.Title),
         "-y",
-        filepath.Join(p.Paths.MP4Dir, "audio.m4a"),
+        filepath.Join(p.Paths.MP4Dir, track.MP4File),
     }
-    return runFFmpeg(args)
-}
 
-func (p *Processor) generateMP4(inputPath string, res Resolution) error {
-    outputFile := filepath.Join(p.Paths.MP4Dir, fmt.Sprintf("%s.mp4", res.Name))
+    output, err := runFFmpegCaptureContext(ctx, args)
+    if err != nil {
+        return LoudnessReport{}, fmt.Errorf("audio extraction failed for %s: %w", track.Name, err)
+    }
 
-    var scaleFilter string
-    if p.VideoInfo.IsVertical {
-        scaleFilter = fmt.Sprintf("scale=-2:%d", res.Height)
-    } else {
-        scaleFilter = fmt.Sprintf("scale=%d:-2", res.Width)
+    var normalized *loudnormOutput
+    if strings.Contains(filter, "loudnorm") {
+        if normalized, err = parseLoudnormOutput(output); err != nil {
+            return LoudnessReport{}, err
+        }
     }
 
-    filterComplex := fmt.Sprintf("%s,format=yuv420p", scaleFilter)
+    return newLoudnessReport(track, p.loudnessTarget(), measured, normalized), nil
+}
+
+func (p *Processor) generateMP4(ctx context.Context, inputPath string, res Resolution, threads int) error {
+    outputFile := filepath.Join(p.Paths.MP4Dir, fmt.Sprintf("%s.mp4", res.Name))
 
-    args := []string{
+    inputs, filter := p.renditionFilter(res)
+    args := append([]string{
         "-v", "error",
         "-i", inputPath,
-        "-an",
-        "-c:v", "libx264",
+    }, inputs...)
+    args = append(args, filter...)
 
-        "-b:v", res.Bitrate,
-        "-maxrate", res.Bitrate,
-        "-bufsize", fmt.Sprintf("%dk", getBufsize(res.Bitrate)),
+    return runPasses(ctx, encodePasses(res, p.passLog(res.Name)), func(pass encodePass) []string {
+        return append(args[:len(args):len(args)], p.videoEncodeArgs(res, outputFile, threads, pass)...)
+    })
+}
 
-        "-vf", filterComplex,
+// renditionFilter returns the inputs that follow the source and the filter
+// options that turn it into one ladder rendition.
+func (p *Processor) renditionFilter(res Resolution) ([]string, []string) {
+    scaleFilter := p.cadenceFilter() + p.cropFilter() + p.ladderScale(res)
 
-        "-preset", "veryfast",
-        "-tune", "zerolatency",
+    if p.Config.Watermark != nil {
+        return []string{"-i", p.Config.Watermark.ImagePath},
+            []string{"-filter_complex", p.watermarkFilter(scaleFilter, res), "-map", "[v]"}
+    }
+    return nil, []string{"-vf", fmt.Sprintf("%s,format=yuv420p", scaleFilter)}
+}
+
+// videoEncodeArgs are the output options of one ladder encode. threads caps
+// the encoder's threads; 0 leaves the choice to ffmpeg.
+func (p *Processor) videoEncodeArgs(res Resolution, outputFile string, threads int, pass encodePass) []string {
+    return p.encodeArgs(res, p.ladderKeyframeArgs(), outputFile, threads, pass)
+}
+
+func (p *Processor) ladderKeyframeArgs() []string {
+    keyframeArgs := []string{
+        "-keyint_min", fmt.Sprintf("%d", p.keyframeInterval()/2),
+        "-g", fmt.Sprintf("%d", p.keyframeInterval()),
+    }
+    if p.alignSegments() {
+        // The GOP limit only backs up the forced schedule, whose gaps can
+        // stretch to three seconds around a cut.
+        keyframeArgs = []string{
+            "-force_key_frames", p.sceneKeyframes(),
+            "-g", fmt.Sprintf("%d", p.keyframeInterval()*3/2),
+        }
+    }
+    return keyframeArgs
+}
+
+func (p *Processor) encodeArgs(res Resolution, keyframeArgs []string, outputFile string, threads int, pass encodePass) []string {
+    args := append([]string{"-an"}, p.videoCodecArgs(res, keyframeArgs, threads)...)
+    args = append(args, "-movflags", "+faststart+rtphint")
+    return append(args, passOutput(pass, outputFile)...)
+}
+
+// videoCodecArgs are the encoder options shared by every video output,
+// whatever the container.
+func (p *Processor) videoCodecArgs(res Resolution, keyframeArgs []string, threads int) []string {
+    args := []string{
+        "-c:v", p.profile().Video.Codec,
+    }
+    args = append(args, rateControlArgs(res)...)
+    args = append(args,
+        "-preset", p.profile().Video.Preset,
         "-profile:v", "high",
-        "-level", "4.1",
-        
-        "-keyint_min", "30",
-        "-g", "60",
+        "-level", p.levelArg(res),
+    )
+    args = append(args, keyframeArgs...)
+    args = append(args,
         "-sc_threshold", "0",
-        
-        "-movflags", "+faststart+rtphint",
+        "-fps_mode", "cfr",
         "-pix_fmt", "yuv420p",
-        
         "-metadata", "encoded_by=ShortRelay",
-        
-        "-y",
-        outputFile,
+    )
+    if threads > 0 {
+        args = append(args, "-threads", fmt.Sprintf("%d", threads))
     }
-
-    return runFFmpeg(args)
+    return args
 }
 
 func (p *Processor) GenerateHLSPlaylists() error {
@@ -145,14 +353,25 @@ func (p *Processor) GenerateHLSPlaylists() error {
         return err
     }
 
-    for _, res := range p.Resolutions {
-        if err := p.generateHLSStream(res); err != nil {
+    if err := p.prepareEncryption(); err != nil {
+        return err
+    }
+
+    // Low-latency streams were already written while the ladder encoded.
+    if !p.lowLatency() {
+        if err := p.generateStreams(); err != nil {
             return err
         }
     }
 
-    if p.VideoInfo.HasAudio {
-        if err := p.generateAudioStream(); err != nil {
+    if len(p.Chapters) > 0 {
+        if err := p.addChapterMarkers(); err != nil {
+            return err
+        }
+    }
+
+    if len(p.VerticalResolutions) > 0 {
+        if err := p.generateVerticalMaster(); err != nil {
             return err
         }
     }
@@ -160,20 +379,84 @@ func (p *Processor) GenerateHLSPlaylists() error {
     return p.generateMasterPlaylist()
 }
 
-func (p *Processor) generateHLSStream(res Resolution) error {
-    streamDir := filepath.Join(p.Paths.HLSDir, "video", res.Name)
+func (p *Processor) generateStreams() error {
+    if err := p.generateSubtitleStreams(); err != nil {
+        return err
+    }
+    if p.packagerProtectionArgs() != nil {
+        return p.packageProtected()
+    }
+    return p.runJobs(append(p.videoStreamJobs(), p.audioStreamJobs()...))
+}
+
+func (p *Processor) generateSubtitleStreams() error {
+    for _, track := range p.SubtitleTracks {
+        if err := p.generateSubtitleStream(track); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// videoStreamJobs segment the ladder and vertical renditions. Segmenting
+// only copies streams, so each job holds a single thread.
+func (p *Processor) videoStreamJobs() []Job {
+    var jobs []Job
+    for _, res := range p.Resolutions {
+        res := res
+        jobs = append(jobs, Job{
+            Name:    res.Name,
+            Threads: 1,
+            Run: func(ctx context.Context, threads int) error {
+                return p.generateHLSStream(ctx, res)
+            },
+        })
+    }
+    for _, res := range p.VerticalResolutions {
+        res := res
+        jobs = append(jobs, Job{
+            Name:    "vertical " + res.Name,
+            Threads: 1,
+            Run: func(ctx context.Context, threads int) error {
+                return p.segmentVideo(ctx, p.verticalMP4(res), p.verticalStreamDir(res))
+            },
+        })
+    }
+    return jobs
+}
+
+func (p *Processor) audioStreamJobs() []Job {
+    var jobs []Job
+    for _, track := range p.AudioTracks {
+        track := track
+        jobs = append(jobs, Job{
+            Name:    "audio " + track.Name,
+            Threads: 1,
+            Run: func(ctx context.Context, threads int) error {
+                return p.generateAudioStream(ctx, track)
+            },
+        })
+    }
+    return jobs
+}
+
+func (p *Processor) generateHLSStream(ctx context.Context, res Resolution) error {
+    return p.segmentVideo(ctx,
+        filepath.Join(p.Paths.MP4Dir, fmt.Sprintf("%s.mp4", res.Name)),
+        filepath.Join(p.Paths.HLSDir, "video", res.Name))
+}
+
+func (p *Processor) segmentVideo(ctx context.Context, inputFile, streamDir string) error {
     if err := os.MkdirAll(streamDir, 0755); err != nil {
         return fmt.Errorf("failed to create video directory: %v", err)
     }
 
-    inputFile := filepath.Join(p.Paths.MP4Dir, fmt.Sprintf("%s.mp4", res.Name))
-    audioFile := filepath.Join(p.Paths.MP4Dir, "audio.m4a")
-
     args := []string{
         "-i", inputFile,
     }
 
     if p.VideoInfo.HasAudio {
+        audioFile := filepath.Join(p.Paths.MP4Dir, p.defaultAudioTrack().MP4File)
         args = append(args,
             "-i", audioFile,
             "-map", "0:v:0",
@@ -185,98 +468,205 @@ func (p *Processor) generateHLSStream(res Resolution) error {
         "-c:v", "copy",
         "-c:a", "copy",
         "-f", "hls",
-        "-hls_time", "2",
+        "-hls_time", p.hlsSegmentTime(),
         "-hls_playlist_type", "vod",
-        "-hls_flags", "independent_segments+program_date_time+discont_start",
         "-hls_segment_type", "fmp4",
         "-hls_fmp4_init_filename", "init.mp4",
         "-hls_list_size", "0",
-        "-start_number", "0",
-        "-hls_segment_filename", "data%03d.m4s",
-        "stream.m3u8")
+        "-start_number", "0")
+    args = append(args, p.hlsSegmentArgs("independent_segments+program_date_time+discont_start")...)
+    args = append(args, p.hlsEncryptionArgs()...)
+    args = append(args, "stream.m3u8")
 
-    cmd := exec.Command("ffmpeg", args...)
+    cmd := exec.CommandContext(ctx, "ffmpeg", args...)
     cmd.Dir = streamDir
     cmd.Stdout = os.Stdout
     cmd.Stderr = os.Stderr
-    return cmd.Run()
+    return commandError(ctx, cmd.Run())
 }
 
-func (p *Processor) generateAudioStream() error {
-    audioDir := filepath.Join(p.Paths.HLSDir, "audio")
+func (p *Processor) generateAudioStream(ctx context.Context, track AudioTrack) error {
+    audioDir := filepath.Join(p.Paths.HLSDir, track.PlaylistDir)
     if err := os.MkdirAll(audioDir, 0755); err != nil {
         return fmt.Errorf("failed to create audio directory: %v", err)
     }
 
     args := []string{
         "-v", "error",
-        "-i", filepath.Join(p.Paths.MP4Dir, "audio.m4a"),
+        "-i", filepath.Join(p.Paths.MP4Dir, track.MP4File),
         "-c:a", "copy",
         "-f", "hls",
-        "-hls_time", "2",
+        "-hls_time", p.segmentDuration(),
         "-hls_playlist_type", "vod",
-        "-hls_flags", "independent_segments+program_date_time",
         "-hls_segment_type", "fmp4",
         "-hls_fmp4_init_filename", "init.mp4",
         "-hls_list_size", "0",
-        "-hls_segment_filename", "data%03d.m4s",
-        "stream.m3u8",
     }
+    args = append(args, p.hlsSegmentArgs("independent_segments+program_date_time")...)
+    args = append(args, p.hlsEncryptionArgs()...)
+    args = append(args, "stream.m3u8")
 
-    cmd := exec.Command("ffmpeg", args...)
+    cmd := exec.CommandContext(ctx, "ffmpeg", args...)
     cmd.Dir = audioDir
     cmd.Stdout = os.Stdout
     cmd.Stderr = os.Stderr
-    return cmd.Run()
+    return commandError(ctx, cmd.Run())
+}
+
+func (p *Processor) generateSubtitleStream(track SubtitleTrack) error {
+    data, err := os.ReadFile(filepath.Join(p.Paths.MP4Dir, track.VTTFile))
+    if err != nil {
+        return fmt.Errorf("failed to read subtitles %s: %v", track.Name, err)
+    }
+
+    cues, err := parseWebVTT(string(data))
+    if err != nil {
+        return fmt.Errorf("failed to parse subtitles %s: %v", track.Name, err)
+    }
+
+    return writeSegmentedWebVTT(cues, filepath.Join(p.Paths.HLSDir, track.PlaylistDir), p.VideoInfo.Duration)
 }
 
 func (p *Processor) generateMasterPlaylist() error {
+    masterFile := filepath.Join(p.Paths.HLSDir, "master.m3u8")
+    return os.WriteFile(masterFile, []byte(p.buildMasterPlaylist(p.Resolutions, "", true)), 0644)
+}
+
+// buildMasterPlaylist lists the given video renditions from video/<name>/ next
+// to the master, with the shared audio and subtitle renditions under
+// mediaPrefix. I-frame playlists are only listed once they exist.
+func (p *Processor) buildMasterPlaylist(resolutions []Resolution, mediaPrefix string, iframes bool) string {
     masterPlaylist := []string{
         "#EXTM3U",
         "#EXT-X-VERSION:6",
         "",
     }
 
-    if p.VideoInfo.HasAudio {
-        masterPlaylist = append(masterPlaylist,
-            "#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"audio\",NAME=\"Original\","+
-                "DEFAULT=YES,AUTOSELECT=YES,LANGUAGE=\"und\","+
-                "CHANNELS=\"2\",URI=\"audio/stream.m3u8\"",
-            "")
+    groups := p.audioGroups()
+    for _, group := range groups {
+        for _, track := range group.Tracks {
+            masterPlaylist = append(masterPlaylist,
+                fmt.Sprintf("#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"%s\",NAME=\"%s\","+
+                    "DEFAULT=%s,AUTOSELECT=%s,LANGUAGE=\"%s\","+
+                    "CHANNELS=\"%d\",URI=\"%s%s/stream.m3u8\"",
+                    group.ID, track.Title, yesNo(track.Default), yesNo(track.AutoSelect),
+                    track.Language, track.Channels, mediaPrefix, filepath.ToSlash(track.PlaylistDir)))
+        }
+        masterPlaylist = append(masterPlaylist, "")
     }
 
-    for _, res := range p.Resolutions {
-        bandwidth := getBandwidth(res.Bitrate)
-        frameRate := "30"
-        
+    subtitles := ""
+    for _, track := range p.SubtitleTracks {
         masterPlaylist = append(masterPlaylist,
-            fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d,"+
-                "FRAME-RATE=%s,CODECS=\"avc1.640028,mp4a.40.2\",AUDIO=\"audio\"",
-                bandwidth, res.Width, res.Height, frameRate),
-            fmt.Sprintf("video/%s/stream.m3u8", res.Name))
+            fmt.Sprintf("#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=\"%s\",NAME=\"%s\","+
+                "DEFAULT=%s,AUTOSELECT=YES,FORCED=%s,LANGUAGE=\"%s\","+
+                "URI=\"%s%s/stream.m3u8\"",
+                subtitleGroup, track.Title, yesNo(track.Default), yesNo(track.Forced),
+                track.Language, mediaPrefix, filepath.ToSlash(track.PlaylistDir)))
+        subtitles = fmt.Sprintf(",SUBTITLES=\"%s\"", subtitleGroup)
+    }
+    if len(p.SubtitleTracks) > 0 {
+        masterPlaylist = append(masterPlaylist, "")
+    }
+
+    for _, res := range resolutions {
+        bandwidth := peakBandwidth(res)
+        frameRate := fmt.Sprintf("%.3f", p.outputFrameRate())
+
+        if len(groups) == 0 {
+            masterPlaylist = append(masterPlaylist,
+                fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d,"+
+                    "FRAME-RATE=%s,CODECS=\"%s\"%s",
+                    bandwidth, res.Width, res.Height, frameRate, p.videoCodec(res), subtitles),
+                fmt.Sprintf("video/%s/stream.m3u8", res.Name))
+            continue
+        }
+
+        for _, group := range groups {
+            codecs := append([]string{p.videoCodec(res)}, group.codecs()...)
+            masterPlaylist = append(masterPlaylist,
+                fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d,"+
+                    "FRAME-RATE=%s,CODECS=\"%s\",AUDIO=\"%s\"%s",
+                    bandwidth+group.bandwidth(), res.Width, res.Height, frameRate,
+                    strings.Join(codecs, ","), group.ID, subtitles),
+                fmt.Sprintf("video/%s/stream.m3u8", res.Name))
+        }
     }
 
-    masterFile := filepath.Join(p.Paths.HLSDir, "master.m3u8")
-    return os.WriteFile(masterFile, []byte(strings.Join(masterPlaylist, "\n")), 0644)
+    if iframes && len(p.iframeBandwidths) > 0 {
+        masterPlaylist = append(masterPlaylist, "")
+        for _, res := range resolutions {
+            if bandwidth, ok := p.iframeBandwidths[res.Name]; ok {
+                masterPlaylist = append(masterPlaylist, p.iframeStreamInf(res, bandwidth))
+            }
+        }
+    }
+
+    return strings.Join(masterPlaylist, "\n")
 }
 
 func (p *Processor) GenerateIframePlaylists() error {
-
-    iframeDir := filepath.Join(p.Paths.HLSDir, "iframe")
-    if err := os.MkdirAll(iframeDir, 0755); err != nil {
-        return fmt.Errorf("failed to create iframe directory: %v", err)
+    if err := p.prepareEncryption(); err != nil {
+        return err
     }
 
-    for _, res := range p.Resolutions {
-        if err := p.generateIframePlaylist(res); err != nil {
+    // Whole-segment AES-128 cannot be decrypted from a byte range, so those
+    // assets keep dedicated keyframe-only encodes.
+    if p.encryptionMethod() == EncryptionAES128 {
+        iframeDir := filepath.Join(p.Paths.HLSDir, "iframe")
+        if err := os.MkdirAll(iframeDir, 0755); err != nil {
+            return fmt.Errorf("failed to create iframe directory: %v", err)
+        }
+
+        var jobs []Job
+        shares := threadShares(p.Resolutions, p.threadBudget())
+        for i, res := range p.Resolutions {
+            res := res
+            jobs = append(jobs, Job{
+                Name:    res.Name,
+                Threads: shares[i],
+                Run: func(ctx context.Context, threads int) error {
+                    return p.generateIframePlaylist(ctx, res, threads)
+                },
+            })
+        }
+        if err := p.runJobs(jobs); err != nil {
             return err
         }
+
+        return p.generateMasterIframePlaylist()
+    }
+
+    var jobs []Job
+    bandwidths := make([]int, len(p.Resolutions))
+    for i, res := range p.Resolutions {
+        i, res := i, res
+        jobs = append(jobs, Job{
+            Name:    res.Name,
+            Threads: 1,
+            Run: func(ctx context.Context, threads int) error {
+                bandwidth, err := p.generateByteRangeIframePlaylist(res)
+                bandwidths[i] = bandwidth
+                return err
+            },
+        })
+    }
+    if err := p.runJobs(jobs); err != nil {
+        return err
     }
 
+    p.iframeBandwidths = make(map[string]int)
+    for i, res := range p.Resolutions {
+        p.iframeBandwidths[res.Name] = bandwidths[i]
+    }
+
+    if err := p.generateMasterPlaylist(); err != nil {
+        return err
+    }
     return p.generateMasterIframePlaylist()
 }
 
-func (p *Processor) generateIframePlaylist(res Resolution) error {
+func (p *Processor) generateIframePlaylist(ctx context.Context, res Resolution, threads int) error {
     resIframeDir := filepath.Join(p.Paths.HLSDir, "iframe", res.Name)
     if err := os.MkdirAll(resIframeDir, 0755); err != nil {
         return err
@@ -291,14 +681,29 @@ func (p *Processor) generateIframePlaylist(res Resolution) error {
         "-c:v", "libx264",
         "-an",
         "-x264-params", "keyint=1:scenecut=0",
+        "-profile:v", "high",
+        "-level", p.levelArg(res),
         "-crf", "17",
         "-preset", "veryfast",
+        "-threads", fmt.Sprintf("%d", threads),
         tempFile,
     }
 
-    cmd := exec.Command("ffmpeg", keyframeArgs...)
+    cmd := exec.CommandContext(ctx, "ffmpeg", keyframeArgs...)
     if err := cmd.Run(); err != nil {
-        return fmt.Errorf("keyframe generation failed: %v", err)
+        return fmt.Errorf("keyframe generation failed: %w", commandError(ctx, err))
+    }
+    defer os.Remove(tempFile)
+
+    if protectionArgs := p.packagerProtectionArgs(); protectionArgs != nil {
+        return p.runPackager([]packagerStream{{
+            Input:        tempFile,
+            Stream:       "video",
+            Dir:          filepath.Join("iframe", res.Name),
+            SegmentName:  "iframe",
+            PlaylistName: "iframe.m3u8",
+            DRMLabel:     p.drmLabel(drmLabelVideo),
+        }}, protectionArgs)
     }
 
     args := []string{
@@ -307,7 +712,7 @@ func (p *Processor) generateIframePlaylist(res Resolution) error {
         "-c:v", "copy",
         "-an",
         "-f", "hls",
-        "-hls_time", "2",
+        "-hls_time", p.segmentDuration(),
         "-hls_playlist_type", "vod",
         "-hls_flags", "independent_segments+program_date_time+discont_start",
         "-hls_segment_type", "fmp4",
@@ -315,18 +720,15 @@ func (p *Processor) generateIframePlaylist(res Resolution) error {
         "-hls_list_size", "0",
         "-start_number", "0",
         "-hls_segment_filename", "iframe%03d.m4s",
-        "iframe.m3u8",
     }
+    args = append(args, p.hlsEncryptionArgs()...)
+    args = append(args, "iframe.m3u8")
 
-    cmd = exec.Command("ffmpeg", args...)
+    cmd = exec.CommandContext(ctx, "ffmpeg", args...)
     cmd.Dir = resIframeDir
     cmd.Stdout = os.Stdout
     cmd.Stderr = os.Stderr
-    err := cmd.Run()
-
-    os.Remove(tempFile)
-
-    return err
+    return cmd.Run()
 }
 
 func (p *Processor) generateMasterIframePlaylist() error {
@@ -339,15 +741,20 @@ func (p *Processor) generateMasterIframePlaylist() error {
     }
 
     for _, res := range p.Resolutions {
+        if bandwidth, ok := p.iframeBandwidths[res.Name]; ok {
+            masterPlaylist = append(masterPlaylist, p.iframeStreamInf(res, bandwidth))
+            continue
+        }
+
         bandwidth := getBandwidth(res.Bitrate) / 4
         
         masterPlaylist = append(masterPlaylist,
             fmt.Sprintf("#EXT-X-STREAM-INF:"+
                 "BANDWIDTH=%d,"+
                 "RESOLUTION=%dx%d,"+
-                "CODECS=\"avc1.640028\"",
+                "CODECS=\"%s\"",
                 bandwidth,
-                res.Width, res.Height),
+                res.Width, res.Height, p.videoCodec(res)),
             fmt.Sprintf("iframe/%s/iframe.m3u8", res.Name))
     }
 
@@ -355,8 +762,8 @@ func (p *Processor) generateMasterIframePlaylist() error {
     return os.WriteFile(masterFile, []byte(strings.Join(masterPlaylist, "\n")), 0644)
 }
 
-func Process(inputPath string, resolutions []Resolution) error {
-    processor, err := NewProcessor(inputPath, resolutions)
+func Process(inputPath string, resolutions []Resolution, config *ProcessorConfig) error {
+    processor, err := NewProcessor(inputPath, resolutions, config)
     if err != nil {
         return err
     }
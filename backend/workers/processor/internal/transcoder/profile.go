@@ -0,0 +1,253 @@
+package transcoder
+
+import (
+    "bytes"
+    "fmt"
+    "math"
+    "strconv"
+
+    "gopkg.in/yaml.v3"
+)
+
+const DefaultProfileName = "default"
+
+var x264Presets = map[string]bool{
+    "ultrafast": true, "superfast": true, "veryfast": true, "faster": true, "fast": true,
+    "medium": true, "slow": true, "slower": true, "veryslow": true, "placebo": true,
+}
+
+// Profile is a named set of encoding settings. Sections left out of a loaded
+// profile keep the built-in defaults.
+type Profile struct {
+    Name       string           `yaml:"name"`
+    Renditions []Resolution     `yaml:"renditions"`
+    Video      VideoProfile     `yaml:"video"`
+    Audio      AudioProfile     `yaml:"audio"`
+    Packaging  PackagingProfile `yaml:"packaging"`
+    Thumbnails ThumbnailProfile `yaml:"thumbnails"`
+}
+
+// VideoProfile holds the encoder settings shared by every rendition. GOP is
+// the keyframe interval in seconds.
+type VideoProfile struct {
+    Codec  string  `yaml:"codec"`
+    Preset string  `yaml:"preset"`
+    GOP    float64 `yaml:"gop"`
+}
+
+// AudioProfile applies to the stereo tracks; surround tracks keep their own
+// codec and bitrate.
+type AudioProfile struct {
+    Codec      string `yaml:"codec"`
+    Bitrate    string `yaml:"bitrate"`
+    SampleRate int    `yaml:"sampleRate"`
+    Channels   int    `yaml:"channels"`
+}
+
+type PackagingProfile struct {
+    SegmentDuration float64 `yaml:"segmentDuration"`
+    Layout          string  `yaml:"layout"`
+}
+
+type ThumbnailProfile struct {
+    MaxWidth  int `yaml:"maxWidth"`
+    MaxHeight int `yaml:"maxHeight"`
+}
+
+// ProfileSet is the parsed profiles file. Default names the profile used
+// when a task does not ask for one; when empty, the first profile is used.
+type ProfileSet struct {
+    Default  string    `yaml:"default"`
+    Profiles []Profile `yaml:"profiles"`
+}
+
+// DefaultProfile reproduces the settings used before profiles existed.
+func DefaultProfile() Profile {
+    return Profile{
+        Name:       DefaultProfileName,
+        Renditions: append([]Resolution(nil), DefaultLadder...),
+        Video:      VideoProfile{Codec: "libx264", Preset: "veryfast", GOP: 2},
+        Audio:      AudioProfile{Codec: "aac", Bitrate: "128k", SampleRate: 44100, Channels: 2},
+        Packaging:  PackagingProfile{SegmentDuration: 2},
+        Thumbnails: ThumbnailProfile{MaxWidth: 1920, MaxHeight: 1080},
+    }
+}
+
+// ParseProfiles decodes and validates a profiles document. YAML is parsed
+// strictly, and JSON is accepted as the YAML subset it is.
+func ParseProfiles(data []byte) (*ProfileSet, error) {
+    set := &ProfileSet{}
+    decoder := yaml.NewDecoder(bytes.NewReader(data))
+    decoder.KnownFields(true)
+    if err := decoder.Decode(set); err != nil {
+        return nil, fmt.Errorf("failed to parse profiles: %v", err)
+    }
+
+    if len(set.Profiles) == 0 {
+        return nil, fmt.Errorf("profiles file defines no profiles")
+    }
+    names := make(map[string]bool)
+    for i := range set.Profiles {
+        profile := &set.Profiles[i]
+        if profile.Name == "" {
+            return nil, fmt.Errorf("profile %d has no name", i)
+        }
+        if names[profile.Name] {
+            return nil, fmt.Errorf("duplicate profile %s", profile.Name)
+        }
+        names[profile.Name] = true
+
+        profile.applyDefaults()
+        if err := profile.Validate(); err != nil {
+            return nil, fmt.Errorf("profile %s: %v", profile.Name, err)
+        }
+    }
+
+    if set.Default == "" {
+        set.Default = set.Profiles[0].Name
+    }
+    if !names[set.Default] {
+        return nil, fmt.Errorf("default profile %s is not defined", set.Default)
+    }
+    return set, nil
+}
+
+// Profile looks up a profile by name, with an empty name selecting the
+// default. A nil set serves only the built-in profile.
+func (s *ProfileSet) Profile(name string) (*Profile, error) {
+    if s == nil {
+        if name != "" && name != DefaultProfileName {
+            return nil, fmt.Errorf("unknown profile: %s", name)
+        }
+        profile := DefaultProfile()
+        return &profile, nil
+    }
+
+    if name == "" {
+        name = s.Default
+    }
+    for i := range s.Profiles {
+        if s.Profiles[i].Name == name {
+            profile := s.Profiles[i]
+            profile.Renditions = append([]Resolution(nil), profile.Renditions...)
+            return &profile, nil
+        }
+    }
+    return nil, fmt.Errorf("unknown profile: %s", name)
+}
+
+func (p *Profile) applyDefaults() {
+    defaults := DefaultProfile()
+    if len(p.Renditions) == 0 {
+        p.Renditions = defaults.Renditions
+    }
+    if p.Video.Codec == "" {
+        p.Video.Codec = defaults.Video.Codec
+    }
+    if p.Video.Preset == "" {
+        p.Video.Preset = defaults.Video.Preset
+    }
+    if p.Video.GOP == 0 {
+        p.Video.GOP = defaults.Video.GOP
+    }
+    if p.Audio.Codec == "" {
+        p.Audio.Codec = defaults.Audio.Codec
+    }
+    if p.Audio.Bitrate == "" {
+        p.Audio.Bitrate = defaults.Audio.Bitrate
+    }
+    if p.Audio.SampleRate == 0 {
+        p.Audio.SampleRate = defaults.Audio.SampleRate
+    }
+    if p.Audio.Channels == 0 {
+        p.Audio.Channels = defaults.Audio.Channels
+    }
+    if p.Packaging.SegmentDuration == 0 {
+        p.Packaging.SegmentDuration = defaults.Packaging.SegmentDuration
+    }
+    if p.Thumbnails.MaxWidth == 0 {
+        p.Thumbnails.MaxWidth = defaults.Thumbnails.MaxWidth
+    }
+    if p.Thumbnails.MaxHeight == 0 {
+        p.Thumbnails.MaxHeight = defaults.Thumbnails.MaxHeight
+    }
+}
+
+// Validate rejects settings the pipeline cannot honour. The encode arguments
+// and CODECS attributes are written for x264 and AAC, so those are the only
+// codecs accepted, and each rendition must fit an H.264 level.
+func (p *Profile) Validate() error {
+    names := make(map[string]bool)
+    for _, res := range p.Renditions {
+        if res.Name == "" {
+            return fmt.Errorf("rendition has no name")
+        }
+        if names[res.Name] {
+            return fmt.Errorf("duplicate rendition %s", res.Name)
+        }
+        names[res.Name] = true
+        if res.Width <= 0 || res.Height <= 0 || res.Width%2 != 0 || res.Height%2 != 0 {
+            return fmt.Errorf("rendition %s: dimensions must be positive and even", res.Name)
+        }
+        if err := validateRateControl(res); err != nil {
+            return err
+        }
+        if _, err := h264Level(res.Width, res.Height, 0, peakBandwidth(res)/1000); err != nil {
+            return fmt.Errorf("rendition %s: %v", res.Name, err)
+        }
+    }
+
+    if p.Video.Codec != "libx264" {
+        return fmt.Errorf("unsupported video codec: %s", p.Video.Codec)
+    }
+    if !x264Presets[p.Video.Preset] {
+        return fmt.Errorf("unknown preset: %s", p.Video.Preset)
+    }
+    if p.Video.GOP <= 0 {
+        return fmt.Errorf("gop must be positive")
+    }
+
+    if p.Audio.Codec != "aac" {
+        return fmt.Errorf("unsupported audio codec: %s", p.Audio.Codec)
+    }
+    if getBitrate(p.Audio.Bitrate) <= 0 {
+        return fmt.Errorf("invalid audio bitrate: %s", p.Audio.Bitrate)
+    }
+    if p.Audio.SampleRate <= 0 {
+        return fmt.Errorf("invalid audio sample rate: %d", p.Audio.SampleRate)
+    }
+    if p.Audio.Channels != 1 && p.Audio.Channels != 2 {
+        return fmt.Errorf("audio channels must be 1 or 2")
+    }
+
+    // Segments can only be cut on keyframes, so a segment must span a whole
+    // number of GOPs.
+    segments := p.Packaging.SegmentDuration / p.Video.GOP
+    if p.Packaging.SegmentDuration <= 0 || segments < 1 || math.Abs(segments-math.Round(segments)) > 1e-6 {
+        return fmt.Errorf("segment duration %g is not a multiple of the %gs gop", p.Packaging.SegmentDuration, p.Video.GOP)
+    }
+    if _, err := ParseHLSLayout(p.Packaging.Layout); err != nil {
+        return err
+    }
+
+    if p.Thumbnails.MaxWidth <= 0 || p.Thumbnails.MaxHeight <= 0 {
+        return fmt.Errorf("thumbnail bounds must be positive")
+    }
+    return nil
+}
+
+// profile is always set once NewProcessor has run.
+func (p *Processor) profile() *Profile {
+    return p.Config.Profile
+}
+
+func (p *Processor) segmentDuration() string {
+    return strconv.FormatFloat(p.profile().Packaging.SegmentDuration, 'f', -1, 64)
+}
+
+// thumbnailScale fits the thumbnail inside the profile's bounds without
+// upscaling.
+func (p *Processor) thumbnailScale() string {
+    bounds := p.profile().Thumbnails
+    return fmt.Sprintf("scale=w='min(%d,iw)':h='min(%d,ih)':force_original_aspect_ratio=decrease", bounds.MaxWidth, bounds.MaxHeight)
+}
\ No newline at end of file
@@ -0,0 +1,152 @@
+package transcoder
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestParseProfiles(t *testing.T) {
+    tests := []struct {
+        name     string
+        document string
+        want     string
+        problem  string
+    }{
+        {
+            name: "first profile is the default",
+            document: `
+profiles:
+  - name: mobile
+    renditions:
+      - {name: 480p, width: 854, height: 480, bitrate: 800k}
+  - name: archive
+`,
+            want: "mobile",
+        },
+        {
+            name: "named default",
+            document: `
+default: archive
+profiles:
+  - name: mobile
+  - name: archive
+`,
+            want: "archive",
+        },
+        {name: "JSON", document: `{"profiles": [{"name": "web", "video": {"preset": "fast"}}]}`, want: "web"},
+        {name: "unknown key", document: "profiles:\n  - name: web\n    vidoe: {preset: fast}\n", problem: "field vidoe not found"},
+        {name: "unknown top-level key", document: "profile:\n  - name: web\n", problem: "field profile not found"},
+        {name: "no profiles", document: "default: web\n", problem: "defines no profiles"},
+        {name: "unnamed profile", document: "profiles:\n  - video: {preset: fast}\n", problem: "profile 0 has no name"},
+        {name: "duplicate names", document: "profiles:\n  - name: web\n  - name: web\n", problem: "duplicate profile web"},
+        {name: "undefined default", document: "default: tv\nprofiles:\n  - name: web\n", problem: "default profile tv is not defined"},
+        {name: "invalid profile", document: "profiles:\n  - name: web\n    video: {preset: warp}\n", problem: "profile web: unknown preset: warp"},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            set, err := ParseProfiles([]byte(test.document))
+            if test.problem != "" {
+                if err == nil || !strings.Contains(err.Error(), test.problem) {
+                    t.Errorf("ParseProfiles = %v, want %q", err, test.problem)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if set.Default != test.want {
+                t.Errorf("Default = %s, want %s", set.Default, test.want)
+            }
+        })
+    }
+}
+
+func TestParseProfilesAppliesDefaults(t *testing.T) {
+    set, err := ParseProfiles([]byte("profiles:\n  - name: web\n    audio: {bitrate: 96k}\n    packaging: {segmentDuration: 6}\n"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    profile, err := set.Profile("")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    defaults := DefaultProfile()
+    if len(profile.Renditions) != len(defaults.Renditions) || profile.Video != defaults.Video {
+        t.Errorf("profile = %+v, want the default renditions and video settings", profile)
+    }
+    if profile.Audio.Bitrate != "96k" || profile.Audio.Codec != "aac" || profile.Audio.SampleRate != 44100 {
+        t.Errorf("Audio = %+v, want 96k over the defaults", profile.Audio)
+    }
+    if profile.Packaging.SegmentDuration != 6 || profile.Thumbnails != defaults.Thumbnails {
+        t.Errorf("profile = %+v, want 6s segments and default thumbnails", profile)
+    }
+}
+
+func TestProfileLookup(t *testing.T) {
+    var none *ProfileSet
+    if profile, err := none.Profile(""); err != nil || profile.Name != DefaultProfileName {
+        t.Errorf("nil set Profile(\"\") = %v, %v; want the built-in profile", profile, err)
+    }
+    if _, err := none.Profile("web"); err == nil {
+        t.Error("nil set served an unknown profile")
+    }
+
+    set, err := ParseProfiles([]byte("profiles:\n  - name: web\n"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := set.Profile("tv"); err == nil {
+        t.Error("Profile served an unknown profile")
+    }
+    // Callers adjust rate control per task, which must not leak into the set.
+    profile, _ := set.Profile("web")
+    profile.Renditions[0].RateControl = RateControlTwoPass
+    if again, _ := set.Profile("web"); again.Renditions[0].RateControl != "" {
+        t.Error("Profile returned renditions shared with the set")
+    }
+}
+
+func TestProfileValidate(t *testing.T) {
+    tests := []struct {
+        name    string
+        change  func(p *Profile)
+        problem string
+    }{
+        {name: "default profile", change: func(p *Profile) {}},
+        {name: "segment of three gops", change: func(p *Profile) { p.Packaging.SegmentDuration = 6 }},
+        {name: "fractional gop", change: func(p *Profile) { p.Video.GOP = 0.5; p.Packaging.SegmentDuration = 1.5 }},
+        {name: "segment not a multiple of the gop", change: func(p *Profile) { p.Packaging.SegmentDuration = 3 }, problem: "not a multiple of the 2s gop"},
+        {name: "segment shorter than the gop", change: func(p *Profile) { p.Packaging.SegmentDuration = 1 }, problem: "not a multiple"},
+        {name: "no gop", change: func(p *Profile) { p.Video.GOP = 0 }, problem: "gop must be positive"},
+        {name: "unknown preset", change: func(p *Profile) { p.Video.Preset = "warp" }, problem: "unknown preset"},
+        {name: "other video codec", change: func(p *Profile) { p.Video.Codec = "libx265" }, problem: "unsupported video codec"},
+        {name: "other audio codec", change: func(p *Profile) { p.Audio.Codec = "opus" }, problem: "unsupported audio codec"},
+        {name: "audio bitrate", change: func(p *Profile) { p.Audio.Bitrate = "fast" }, problem: "invalid audio bitrate"},
+        {name: "surround channels", change: func(p *Profile) { p.Audio.Channels = 6 }, problem: "channels must be 1 or 2"},
+        {name: "layout", change: func(p *Profile) { p.Packaging.Layout = "dash" }, problem: "unsupported HLS layout"},
+        {name: "thumbnail bounds", change: func(p *Profile) { p.Thumbnails.MaxWidth = 0 }, problem: "thumbnail bounds"},
+        {name: "duplicate rendition", change: func(p *Profile) { p.Renditions[1].Name = p.Renditions[0].Name }, problem: "duplicate rendition 1080p"},
+        {name: "odd dimensions", change: func(p *Profile) { p.Renditions[2].Width = 853 }, problem: "rendition 480p: dimensions"},
+        {name: "rendition bitrate", change: func(p *Profile) { p.Renditions[0].Bitrate = "" }, problem: "invalid bitrate"},
+        {name: "beyond every level", change: func(p *Profile) { p.Renditions[0].Width, p.Renditions[0].Height = 7680, 4320 }, problem: "rendition 1080p"},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            profile := DefaultProfile()
+            test.change(&profile)
+            err := profile.Validate()
+            if test.problem == "" {
+                if err != nil {
+                    t.Errorf("Validate = %v, want nil", err)
+                }
+                return
+            }
+            if err == nil || !strings.Contains(err.Error(), test.problem) {
+                t.Errorf("Validate = %v, want %q", err, test.problem)
+            }
+        })
+    }
+}
\ No newline at end of file
@@ -0,0 +1,142 @@
+package transcoder
+
+import (
+    "fmt"
+    "math"
+    "regexp"
+    "strconv"
+)
+
+const (
+    QualityPassed   = "PASSED"
+    QualityFlagged  = "FLAGGED"
+    QualityRejected = "REJECTED"
+)
+
+var (
+    blackDuration   = regexp.MustCompile(`black_duration:\s*([0-9.]+)`)
+    freezeStart     = regexp.MustCompile(`freezedetect\.freeze_start:\s*([0-9.]+)`)
+    freezeDuration  = regexp.MustCompile(`freezedetect\.freeze_duration:\s*([0-9.]+)`)
+    silenceStart    = regexp.MustCompile(`silence_start:\s*([0-9.]+)`)
+    silenceDuration = regexp.MustCompile(`silence_duration:\s*([0-9.]+)`)
+)
+
+// QualityThreshold is a percentage of the duration. A zero value disables
+// that level of the check.
+type QualityThreshold struct {
+    Flag   float64
+    Reject float64
+}
+
+type QualityGateConfig struct {
+    Black   QualityThreshold
+    Freeze  QualityThreshold
+    Silence QualityThreshold
+}
+
+func DefaultQualityGate() QualityGateConfig {
+    return QualityGateConfig{
+        Black:   QualityThreshold{Flag: 50, Reject: 95},
+        Freeze:  QualityThreshold{Flag: 50, Reject: 95},
+        Silence: QualityThreshold{Flag: 90},
+    }
+}
+
+type QualityReport struct {
+    BlackPercent   float64
+    FreezePercent  float64
+    SilencePercent float64
+    Verdict        string
+    Reasons        []string
+}
+
+// CheckQuality measures black, frozen and silent time in a single decode and
+// grades it against the configured thresholds. Silence is only checked on the
+// default audio track, and not at all for sources without audio.
+func (p *Processor) CheckQuality() (*QualityReport, error) {
+    config := DefaultQualityGate()
+    if p.Config.QualityGate != nil {
+        config = *p.Config.QualityGate
+    }
+
+    args := []string{
+        "-hide_banner",
+        "-nostats",
+        "-v", "info",
+        "-i", p.InputPath,
+        "-map", "0:v:0",
+        "-vf", "blackdetect=d=0.5:pix_th=0.10,freezedetect=n=-60dB:d=2",
+    }
+    if len(p.AudioTracks) > 0 {
+        args = append(args,
+            "-map", fmt.Sprintf("0:a:%d", p.defaultAudioTrack().StreamIndex),
+            "-af", "silencedetect=n=-50dB:d=2")
+    }
+    args = append(args, "-f", "null", "-")
+
+    output, err := runFFmpegCapture(args)
+    if err != nil {
+        return nil, fmt.Errorf("quality analysis failed: %v", err)
+    }
+
+    report := parseQualityOutput(output, p.VideoInfo.Duration)
+    report.grade("black frames", report.BlackPercent, config.Black)
+    report.grade("frozen video", report.FreezePercent, config.Freeze)
+    if len(p.AudioTracks) > 0 {
+        report.grade("silent audio", report.SilencePercent, config.Silence)
+    }
+    return report, nil
+}
+
+// parseQualityOutput reads the detector logs. freezedetect logs each event
+// once at info level as "key: value"; metadata=print output ("key=value")
+// would repeat it, so only the logged form is matched.
+func parseQualityOutput(output string, duration float64) *QualityReport {
+    return &QualityReport{
+        BlackPercent:   percentOf(sumMatches(blackDuration, output), duration),
+        FreezePercent:  percentOf(openEndedDuration(freezeStart, freezeDuration, output, duration), duration),
+        SilencePercent: percentOf(openEndedDuration(silenceStart, silenceDuration, output, duration), duration),
+        Verdict:        QualityPassed,
+    }
+}
+
+func (r *QualityReport) grade(name string, percent float64, threshold QualityThreshold) {
+    switch {
+    case threshold.Reject > 0 && percent >= threshold.Reject:
+        r.Verdict = QualityRejected
+        r.Reasons = append(r.Reasons, fmt.Sprintf("%s cover %.1f%% of the video (limit %.1f%%)", name, percent, threshold.Reject))
+    case threshold.Flag > 0 && percent >= threshold.Flag:
+        if r.Verdict == QualityPassed {
+            r.Verdict = QualityFlagged
+        }
+        r.Reasons = append(r.Reasons, fmt.Sprintf("%s cover %.1f%% of the video", name, percent))
+    }
+}
+
+func sumMatches(pattern *regexp.Regexp, output string) float64 {
+    total := 0.0
+    for _, match := range pattern.FindAllStringSubmatch(output, -1) {
+        value, _ := strconv.ParseFloat(match[1], 64)
+        total += value
+    }
+    return total
+}
+
+// openEndedDuration adds a detection that was still running when the input
+// ended, which the filters report as a start without a duration.
+func openEndedDuration(start, length *regexp.Regexp, output string, duration float64) float64 {
+    total := sumMatches(length, output)
+    starts := start.FindAllStringSubmatch(output, -1)
+    if len(starts) > len(length.FindAllStringSubmatch(output, -1)) {
+        last, _ := strconv.ParseFloat(starts[len(starts)-1][1], 64)
+        total += math.Max(0, duration-last)
+    }
+    return total
+}
+
+func percentOf(value, duration float64) float64 {
+    if duration <= 0 {
+        return 0
+    }
+    return math.Min(100, value/duration*100)
+}
\ No newline at end of file
@@ -0,0 +1,58 @@
+package transcoder
+
+import (
+    "math"
+    "testing"
+)
+
+const qualitySample = `Input #0, mov,mp4,m4a,3gp,3g2,mj2, from 'input':
+[blackdetect @ 0x5581c0] black_start:0 black_end:1.5 black_duration:1.5
+[silencedetect @ 0x5581d0] silence_start: 3
+[silencedetect @ 0x5581d0] silence_end: 6 | silence_duration: 3
+[freezedetect @ 0x5581e0] lavfi.freezedetect.freeze_start: 10
+[Parsed_metadata_2 @ 0x5581f0] frame:300  pts:300300  pts_time:10.01
+[Parsed_metadata_2 @ 0x5581f0] lavfi.freezedetect.freeze_start=10
+[freezedetect @ 0x5581e0] lavfi.freezedetect.freeze_duration: 24
+[freezedetect @ 0x5581e0] lavfi.freezedetect.freeze_end: 34
+[Parsed_metadata_3 @ 0x558200] lavfi.freezedetect.freeze_duration=24
+[blackdetect @ 0x5581c0] black_start:40 black_end:41 black_duration:1
+[silencedetect @ 0x5581d0] silence_start: 45
+`
+
+func TestParseQualityOutput(t *testing.T) {
+    report := parseQualityOutput(qualitySample, 50)
+
+    tests := []struct {
+        name string
+        got  float64
+        want float64
+    }{
+        // 1.5s + 1s of 50s.
+        {"black", report.BlackPercent, 5},
+        // One 24s freeze; the metadata=print copy must not count again.
+        {"freeze", report.FreezePercent, 48},
+        // 3s closed plus 5s still open at the end of the input.
+        {"silence", report.SilencePercent, 16},
+    }
+    for _, test := range tests {
+        if math.Abs(test.got-test.want) > 1e-9 {
+            t.Errorf("%s: got %.2f%%, want %.2f%%", test.name, test.got, test.want)
+        }
+    }
+}
+
+func TestParseQualityOutputOpenFreeze(t *testing.T) {
+    output := "[freezedetect @ 0x1] lavfi.freezedetect.freeze_start: 20\n"
+    if got := parseQualityOutput(output, 40).FreezePercent; math.Abs(got-50) > 1e-9 {
+        t.Errorf("open freeze: got %.2f%%, want 50%%", got)
+    }
+}
+
+func TestQualityGrade(t *testing.T) {
+    report := parseQualityOutput(qualitySample, 50)
+    config := DefaultQualityGate()
+    report.grade("frozen video", report.FreezePercent, config.Freeze)
+    if report.Verdict != QualityPassed {
+        t.Errorf("48%% frozen: got verdict %s, want %s", report.Verdict, QualityPassed)
+    }
+}
\ No newline at end of file
@@ -0,0 +1,119 @@
+package transcoder
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "path/filepath"
+)
+
+const (
+    RateControlCBR       = "cbr"
+    RateControlCappedCRF = "capped_crf"
+    RateControlTwoPass   = "two_pass"
+
+    defaultCRF = 23
+)
+
+// encodePass is one pass of a rendition encode. Number 0 is a single-pass
+// encode; two-pass encodes share LogFile between passes 1 and 2.
+type encodePass struct {
+    Number  int
+    LogFile string
+}
+
+func validateRateControl(res Resolution) error {
+    switch res.RateControl {
+    case "", RateControlCBR, RateControlTwoPass:
+    case RateControlCappedCRF:
+        if res.CRF < 0 || res.CRF > 51 {
+            return fmt.Errorf("rendition %s: crf must be between 0 and 51", res.Name)
+        }
+    default:
+        return fmt.Errorf("rendition %s: unknown rate control %s", res.Name, res.RateControl)
+    }
+    if getBitrate(res.Bitrate) <= 0 {
+        return fmt.Errorf("rendition %s: invalid bitrate %s", res.Name, res.Bitrate)
+    }
+    return nil
+}
+
+// passLog names the two-pass statistics of one encode, kept with the logs.
+func (p *Processor) passLog(name string) string {
+    return filepath.Join(p.Paths.LogsDir, name+"_passlog")
+}
+
+func encodePasses(res Resolution, logFile string) []encodePass {
+    if res.RateControl != RateControlTwoPass {
+        return []encodePass{{}}
+    }
+    return []encodePass{{Number: 1, LogFile: logFile}, {Number: 2, LogFile: logFile}}
+}
+
+// rateControlArgs sets the bitrate behaviour of a rung. CBR keeps the live-style
+// constant rate; the VOD modes let the encoder spend bits where the content
+// needs them, capped so segments stay within the advertised bandwidth.
+func rateControlArgs(res Resolution) []string {
+    bufsize := fmt.Sprintf("%dk", getBufsize(res.Bitrate))
+    switch res.RateControl {
+    case RateControlCappedCRF:
+        crf := res.CRF
+        if crf == 0 {
+            crf = defaultCRF
+        }
+        return []string{
+            "-crf", fmt.Sprintf("%d", crf),
+            "-maxrate", res.Bitrate,
+            "-bufsize", bufsize,
+        }
+    case RateControlTwoPass:
+        return []string{
+            "-b:v", res.Bitrate,
+            "-maxrate", fmt.Sprintf("%dk", getBitrate(res.Bitrate)*3/2),
+            "-bufsize", bufsize,
+        }
+    default:
+        return []string{
+            "-b:v", res.Bitrate,
+            "-maxrate", res.Bitrate,
+            "-bufsize", bufsize,
+            "-tune", "zerolatency",
+        }
+    }
+}
+
+// passOutput ends the options of one output. The first pass only writes its
+// log, so its video goes to the null muxer.
+func passOutput(pass encodePass, outputFile string) []string {
+    switch pass.Number {
+    case 1:
+        return []string{"-pass", "1", "-passlogfile", pass.LogFile, "-f", "null", "-y", os.DevNull}
+    case 2:
+        return []string{"-pass", "2", "-passlogfile", pass.LogFile, "-y", outputFile}
+    default:
+        return []string{"-y", outputFile}
+    }
+}
+
+// peakBandwidth is the most a rung may spend over a buffer window, which is
+// what the master playlist advertises.
+func peakBandwidth(res Resolution) int {
+    if res.RateControl == RateControlTwoPass {
+        return getBandwidth(res.Bitrate) * 3 / 2
+    }
+    return getBandwidth(res.Bitrate)
+}
+
+// runPasses runs a rendition encode once per pass, building each command
+// with build.
+func runPasses(ctx context.Context, passes []encodePass, build func(pass encodePass) []string) error {
+    for _, pass := range passes {
+        if err := runFFmpegContext(ctx, build(pass)); err != nil {
+            if pass.Number > 0 {
+                return fmt.Errorf("pass %d: %w", pass.Number, err)
+            }
+            return err
+        }
+    }
+    return nil
+}
\ No newline at end of file
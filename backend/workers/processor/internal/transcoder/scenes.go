@@ -0,0 +1,285 @@
+package transcoder
+
+import (
+    "encoding/json"
+    "fmt"
+    "math"
+    "os"
+    "path/filepath"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const (
+    defaultSceneThreshold = 0.4
+    minSceneLength        = 1.0
+    previewClipLength     = 2.0
+    previewClipCount      = 3
+    chapterDateRangeClass = "com.shortrelay.chapter"
+    programDateTag        = "#EXT-X-PROGRAM-DATE-TIME:"
+)
+
+var (
+    scenePTSTime = regexp.MustCompile(`pts_time:([0-9.]+)`)
+    sceneScore   = regexp.MustCompile(`lavfi\.scene_score=([0-9.]+)`)
+)
+
+type SceneConfig struct {
+    Threshold     float64
+    AlignSegments bool
+}
+
+type Chapter struct {
+    Index int     `json:"index"`
+    Start float64 `json:"start"`
+    End   float64 `json:"end"`
+    Score float64 `json:"score"`
+}
+
+type chaptersFile struct {
+    Threshold float64   `json:"threshold"`
+    Duration  float64   `json:"duration"`
+    Chapters  []Chapter `json:"chapters"`
+}
+
+func (p *Processor) sceneThreshold() float64 {
+    if p.Config.Scenes == nil || p.Config.Scenes.Threshold <= 0 {
+        return defaultSceneThreshold
+    }
+    return p.Config.Scenes.Threshold
+}
+
+// detectScenes splits the timeline into chapters at scene cuts. Cuts closer
+// than minSceneLength to the previous one are merged, so flashes and fast
+// edits do not produce one-frame chapters.
+func (p *Processor) detectScenes() error {
+    if p.Config.Scenes == nil {
+        return nil
+    }
+
+    filter := fmt.Sprintf("%s%sscale=320:-2,select='gt(scene,%.3f)',metadata=print",
+        p.cadenceFilter(), p.cropFilter(), p.sceneThreshold())
+    args := []string{
+        "-hide_banner",
+        "-nostats",
+        "-v", "info",
+        "-i", p.InputPath,
+        "-an",
+        "-vf", filter,
+        "-f", "null",
+        "-",
+    }
+
+    output, err := runFFmpegCapture(args)
+    if err != nil {
+        return fmt.Errorf("scene detection failed: %v", err)
+    }
+
+    chapters := []Chapter{{Index: 0, Start: 0}}
+    var cutTime float64
+    for _, line := range strings.Split(output, "\n") {
+        if match := scenePTSTime.FindStringSubmatch(line); match != nil {
+            cutTime, _ = strconv.ParseFloat(match[1], 64)
+            continue
+        }
+        match := sceneScore.FindStringSubmatch(line)
+        if match == nil {
+            continue
+        }
+        score, _ := strconv.ParseFloat(match[1], 64)
+
+        last := &chapters[len(chapters)-1]
+        if cutTime-last.Start < minSceneLength || p.VideoInfo.Duration-cutTime < minSceneLength {
+            continue
+        }
+        last.End = cutTime
+        chapters = append(chapters, Chapter{Index: len(chapters), Start: cutTime, Score: score})
+    }
+    chapters[len(chapters)-1].End = p.VideoInfo.Duration
+
+    p.Chapters = chapters
+    return nil
+}
+
+func (p *Processor) writeChapters() error {
+    data, err := json.MarshalIndent(chaptersFile{
+        Threshold: p.sceneThreshold(),
+        Duration:  p.VideoInfo.Duration,
+        Chapters:  p.Chapters,
+    }, "", "  ")
+    if err != nil {
+        return fmt.Errorf("failed to encode chapters: %v", err)
+    }
+    return os.WriteFile(filepath.Join(p.Paths.AssetsDir, "chapters.json"), data, 0644)
+}
+
+// thumbnailTime picks the middle of the longest scene, which is more likely
+// to be a representative shot than whatever sits at the midpoint.
+func (p *Processor) thumbnailTime() float64 {
+    longest := p.longestChapters(1)
+    if len(longest) == 0 {
+        return p.VideoInfo.Duration / 2
+    }
+    return (longest[0].Start + longest[0].End) / 2
+}
+
+func (p *Processor) longestChapters(count int) []Chapter {
+    chapters := make([]Chapter, 0, len(p.Chapters))
+    for _, chapter := range p.Chapters {
+        if chapter.End-chapter.Start >= minSceneLength {
+            chapters = append(chapters, chapter)
+        }
+    }
+    sort.SliceStable(chapters, func(i, j int) bool {
+        return chapters[i].End-chapters[i].Start > chapters[j].End-chapters[j].Start
+    })
+    if len(chapters) > count {
+        chapters = chapters[:count]
+    }
+    sort.Slice(chapters, func(i, j int) bool { return chapters[i].Start < chapters[j].Start })
+    return chapters
+}
+
+// generatePreview stitches a short muted clip from the middle of the longest
+// scenes, kept in their original order.
+func (p *Processor) generatePreview() error {
+    chapters := p.longestChapters(previewClipCount)
+    if len(chapters) == 0 {
+        return nil
+    }
+
+    scale := "scale=-2:480"
+    if p.VideoInfo.IsVertical {
+        scale = "scale=480:-2"
+    }
+
+    var filters []string
+    var inputs strings.Builder
+    for i, chapter := range chapters {
+        length := math.Min(previewClipLength, chapter.End-chapter.Start)
+        start := (chapter.Start+chapter.End)/2 - length/2
+        filters = append(filters, fmt.Sprintf("[0:v]trim=start=%.3f:end=%.3f,setpts=PTS-STARTPTS,%s%s%s,setsar=1[c%d]",
+            start, start+length, p.cadenceFilter(), p.cropFilter(), scale, i))
+        fmt.Fprintf(&inputs, "[c%d]", i)
+    }
+    filters = append(filters, fmt.Sprintf("%sconcat=n=%d:v=1:a=0,format=yuv420p[v]", inputs.String(), len(chapters)))
+
+    args := []string{
+        "-v", "error",
+        "-i", p.InputPath,
+        "-filter_complex", strings.Join(filters, ";"),
+        "-map", "[v]",
+        "-an",
+        "-c:v", "libx264",
+        "-preset", "veryfast",
+        "-crf", "28",
+        "-movflags", "+faststart",
+        "-y",
+        filepath.Join(p.Paths.AssetsDir, "preview.mp4"),
+    }
+    return runFFmpeg(args)
+}
+
+func (p *Processor) alignSegments() bool {
+    return p.Config.Scenes != nil && p.Config.Scenes.AlignSegments && len(p.Chapters) > 1
+}
+
+// sceneKeyframes schedules a keyframe at every cut and every GOP in between,
+// dropping any regular keyframe that would leave a sliver shorter than
+// minSceneLength before the next cut.
+func (p *Processor) sceneKeyframes() string {
+    gop := p.profile().Video.GOP
+    var times []string
+    next := 0.0
+    for _, chapter := range p.Chapters[1:] {
+        for ; next < chapter.Start-minSceneLength; next += gop {
+            times = append(times, fmt.Sprintf("%.3f", next))
+        }
+        times = append(times, fmt.Sprintf("%.3f", chapter.Start))
+        next = chapter.Start + gop
+    }
+    for ; next < p.VideoInfo.Duration; next += gop {
+        times = append(times, fmt.Sprintf("%.3f", next))
+    }
+    return strings.Join(times, ",")
+}
+
+// hlsSegmentTime is the muxer's target duration. With aligned keyframes it is
+// lowered so the muxer splits at every keyframe, making the forced keyframes
+// the segment boundaries.
+func (p *Processor) hlsSegmentTime() string {
+    if p.alignSegments() {
+        return fmt.Sprintf("%g", minSceneLength)
+    }
+    return p.segmentDuration()
+}
+
+// addChapterMarkers inserts an EXT-X-DATERANGE per chapter into each video
+// media playlist. DATERANGE needs a program date, so playlists without one
+// get an epoch-based EXT-X-PROGRAM-DATE-TIME.
+func (p *Processor) addChapterMarkers() error {
+    playlists, err := filepath.Glob(filepath.Join(p.Paths.HLSDir, "video", "*", "stream.m3u8"))
+    if err != nil {
+        return err
+    }
+    vertical, err := filepath.Glob(filepath.Join(p.Paths.HLSDir, verticalDir, "video", "*", "stream.m3u8"))
+    if err != nil {
+        return err
+    }
+
+    for _, playlist := range append(playlists, vertical...) {
+        if err := p.addChapterMarkersTo(playlist); err != nil {
+            return fmt.Errorf("failed to add chapter markers to %s: %v", playlist, err)
+        }
+    }
+    return nil
+}
+
+func (p *Processor) addChapterMarkersTo(playlist string) error {
+    data, err := os.ReadFile(playlist)
+    if err != nil {
+        return err
+    }
+    lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+
+    insertAt := -1
+    start := time.Unix(0, 0).UTC()
+    hasProgramDate := false
+    for i, line := range lines {
+        if strings.HasPrefix(line, programDateTag) && !hasProgramDate {
+            parsed, err := time.Parse("2006-01-02T15:04:05.999-0700", strings.TrimPrefix(line, programDateTag))
+            if err != nil {
+                parsed, err = time.Parse(time.RFC3339Nano, strings.TrimPrefix(line, programDateTag))
+            }
+            if err == nil {
+                start = parsed.UTC()
+            }
+            hasProgramDate = true
+        }
+        if insertAt < 0 && (strings.HasPrefix(line, "#EXTINF") || strings.HasPrefix(line, programDateTag) ||
+            strings.HasPrefix(line, "#EXT-X-KEY") || strings.HasPrefix(line, "#EXT-X-MAP")) {
+            insertAt = i
+        }
+    }
+    if insertAt < 0 {
+        return fmt.Errorf("no segments found")
+    }
+
+    var markers []string
+    if !hasProgramDate {
+        markers = append(markers, programDateTag+start.Format("2006-01-02T15:04:05.000Z"))
+    }
+    for _, chapter := range p.Chapters {
+        markers = append(markers, fmt.Sprintf(
+            "#EXT-X-DATERANGE:ID=\"chapter-%d\",CLASS=\"%s\",START-DATE=\"%s\",DURATION=%.3f,X-SCENE-SCORE=%.3f",
+            chapter.Index, chapterDateRangeClass,
+            start.Add(time.Duration(chapter.Start*float64(time.Second))).Format("2006-01-02T15:04:05.000Z"),
+            chapter.End-chapter.Start, chapter.Score))
+    }
+
+    updated := append(append(append([]string{}, lines[:insertAt]...), markers...), lines[insertAt:]...)
+    return os.WriteFile(playlist, []byte(strings.Join(updated, "\n")+"\n"), 0644)
+}
\ No newline at end of file
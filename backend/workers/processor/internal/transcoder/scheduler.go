@@ -0,0 +1,187 @@
+package transcoder
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "math"
+    "runtime"
+    "strings"
+    "sync"
+)
+
+// Job is one independent unit of rendition work. Threads is the share of the
+// budget it holds while running; Run receives it to pass on as -threads.
+type Job struct {
+    Name    string
+    Threads int
+    Run     func(ctx context.Context, threads int) error
+}
+
+// Fatal marks a job failure that leaves the other jobs pointless, so the
+// scheduler cancels them instead of letting them finish.
+func Fatal(err error) error {
+    if err == nil {
+        return nil
+    }
+    return &fatalError{err: err}
+}
+
+type fatalError struct {
+    err error
+}
+
+func (e *fatalError) Error() string {
+    return e.err.Error()
+}
+
+func (e *fatalError) Unwrap() error {
+    return e.err
+}
+
+// Scheduler runs jobs concurrently without holding more threads than its
+// budget at any one time.
+type Scheduler struct {
+    budget int
+    free   int
+    mu     sync.Mutex
+    cond   *sync.Cond
+}
+
+func NewScheduler(budget int) *Scheduler {
+    if budget < 1 {
+        budget = 1
+    }
+    s := &Scheduler{budget: budget, free: budget}
+    s.cond = sync.NewCond(&s.mu)
+    return s
+}
+
+// Run starts jobs in order as soon as their threads fit in the budget, and
+// reports every failure together. A failure marked Fatal also cancels the
+// jobs still queued or running; their cancellations are not reported.
+func (s *Scheduler) Run(ctx context.Context, jobs []Job) error {
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+    stop := context.AfterFunc(ctx, func() {
+        s.mu.Lock()
+        s.cond.Broadcast()
+        s.mu.Unlock()
+    })
+    defer stop()
+
+    var wg sync.WaitGroup
+    var mu sync.Mutex
+    var failures []string
+
+    for _, job := range jobs {
+        threads := job.Threads
+        if threads < 1 {
+            threads = 1
+        }
+        if threads > s.budget {
+            threads = s.budget
+        }
+        if !s.acquire(ctx, threads) {
+            break
+        }
+
+        wg.Add(1)
+        go func(job Job, threads int) {
+            defer wg.Done()
+            // Threads go back only after a fatal failure has cancelled, so
+            // no queued job starts in between.
+            defer s.release(threads)
+            err := job.Run(ctx, threads)
+            if err == nil {
+                return
+            }
+
+            if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+                return
+            }
+            mu.Lock()
+            failures = append(failures, fmt.Sprintf("%s: %v", job.Name, err))
+            mu.Unlock()
+
+            var fatal *fatalError
+            if errors.As(err, &fatal) {
+                cancel()
+            }
+        }(job, threads)
+    }
+    wg.Wait()
+
+    if len(failures) == 0 {
+        return ctx.Err()
+    }
+    if len(failures) == 1 {
+        return fmt.Errorf("%s", failures[0])
+    }
+    return fmt.Errorf("%d jobs failed: %s", len(failures), strings.Join(failures, "; "))
+}
+
+func (s *Scheduler) acquire(ctx context.Context, threads int) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    for s.free < threads && ctx.Err() == nil {
+        s.cond.Wait()
+    }
+    if ctx.Err() != nil {
+        return false
+    }
+    s.free -= threads
+    return true
+}
+
+func (s *Scheduler) release(threads int) {
+    s.mu.Lock()
+    s.free += threads
+    s.cond.Broadcast()
+    s.mu.Unlock()
+}
+
+func (p *Processor) threadBudget() int {
+    if p.Config.ThreadBudget > 0 {
+        return p.Config.ThreadBudget
+    }
+    return runtime.NumCPU()
+}
+
+// runJobs runs one stage's jobs. A stage fails as a whole if any of its
+// jobs does, so every failure cancels the rest.
+func (p *Processor) runJobs(jobs []Job) error {
+    return NewScheduler(p.threadBudget()).Run(context.Background(), fatalJobs(jobs))
+}
+
+// fatalJobs marks every failure of jobs as Fatal.
+func fatalJobs(jobs []Job) []Job {
+    wrapped := make([]Job, len(jobs))
+    for i, job := range jobs {
+        run := job.Run
+        job.Run = func(ctx context.Context, threads int) error {
+            return Fatal(run(ctx, threads))
+        }
+        wrapped[i] = job
+    }
+    return wrapped
+}
+
+// threadShares splits a budget across renditions by pixel count, so the
+// largest rendition, which bounds the wall time, gets the most threads.
+func threadShares(resolutions []Resolution, budget int) []int {
+    var total float64
+    for _, res := range resolutions {
+        total += float64(res.Width * res.Height)
+    }
+
+    shares := make([]int, len(resolutions))
+    for i, res := range resolutions {
+        share := 1
+        if total > 0 {
+            share = int(math.Round(float64(budget) * float64(res.Width*res.Height) / total))
+        }
+        shares[i] = int(math.Max(1, math.Min(float64(budget), float64(share))))
+    }
+    return shares
+}
\ No newline at end of file
@@ -0,0 +1,67 @@
+package transcoder
+
+import (
+    "context"
+    "errors"
+    "strings"
+    "testing"
+)
+
+func TestSchedulerReportsEveryFailure(t *testing.T) {
+    finished := false
+    jobs := []Job{
+        {Name: "a", Run: func(ctx context.Context, threads int) error { return errors.New("bad input") }},
+        {Name: "b", Run: func(ctx context.Context, threads int) error { return errors.New("disk full") }},
+        {Name: "c", Run: func(ctx context.Context, threads int) error { finished = true; return nil }},
+    }
+
+    err := NewScheduler(1).Run(context.Background(), jobs)
+    if err == nil || !strings.Contains(err.Error(), "a: bad input") || !strings.Contains(err.Error(), "b: disk full") {
+        t.Errorf("Run = %v, want both failures", err)
+    }
+    if !finished {
+        t.Error("a non-fatal failure cancelled the remaining jobs")
+    }
+}
+
+func TestSchedulerFatalCancels(t *testing.T) {
+    started := make(chan struct{})
+    jobs := []Job{
+        {Name: "slow", Run: func(ctx context.Context, threads int) error {
+            close(started)
+            <-ctx.Done()
+            return commandError(ctx, errors.New("signal: killed"))
+        }},
+        {Name: "broken", Run: func(ctx context.Context, threads int) error {
+            <-started
+            return Fatal(errors.New("chunk failed"))
+        }},
+        {Name: "queued", Threads: 2, Run: func(ctx context.Context, threads int) error {
+            t.Error("a queued job ran after a fatal failure")
+            return nil
+        }},
+    }
+
+    err := NewScheduler(2).Run(context.Background(), jobs)
+    if err == nil || err.Error() != "broken: chunk failed" {
+        t.Errorf("Run = %v, want only the fatal failure", err)
+    }
+}
+
+func TestRunJobsCancelsOnAnyFailure(t *testing.T) {
+    p := &Processor{Config: &ProcessorConfig{ThreadBudget: 2}}
+    jobs := []Job{
+        {Name: "1080p", Run: func(ctx context.Context, threads int) error {
+            <-ctx.Done()
+            return commandError(ctx, errors.New("signal: killed"))
+        }},
+        {Name: "720p", Run: func(ctx context.Context, threads int) error {
+            return errors.New("exit status 1")
+        }},
+    }
+
+    err := p.runJobs(jobs)
+    if err == nil || err.Error() != "720p: exit status 1" {
+        t.Errorf("runJobs = %v, want only the failed rendition", err)
+    }
+}
\ No newline at end of file
@@ -0,0 +1,168 @@
+package transcoder
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// audioJobs extracts every audio track. The reports are filled in as the
+// jobs complete.
+func (p *Processor) audioJobs() ([]Job, []LoudnessReport) {
+    var jobs []Job
+    reports := make([]LoudnessReport, len(p.AudioTracks))
+    for i, track := range p.AudioTracks {
+        i, track := i, track
+        jobs = append(jobs, Job{
+            Name:    "audio " + track.Name,
+            Threads: 1,
+            Run: func(ctx context.Context, threads int) error {
+                report, err := p.extractAudio(ctx, p.InputPath, track)
+                reports[i] = report
+                return err
+            },
+        })
+    }
+    return jobs, reports
+}
+
+// ExtractAudioTracks runs only the audio part of GenerateMP4Files, leaving
+// the video renditions untouched.
+func (p *Processor) ExtractAudioTracks() error {
+    if len(p.AudioTracks) == 0 {
+        return fmt.Errorf("source has no audio streams")
+    }
+    jobs, reports := p.audioJobs()
+    if err := p.runJobs(jobs); err != nil {
+        return err
+    }
+    p.LoudnessReports = append(p.LoudnessReports, reports...)
+    return nil
+}
+
+// manifestFile records, next to the renditions, what the HLS stages need to
+// know about the source, so they can be rerun without it.
+const manifestFile = "manifest.json"
+
+type encodeManifest struct {
+    VideoInfo           *VideoInfo      `json:"videoInfo"`
+    Resolutions         []Resolution    `json:"resolutions"`
+    VerticalResolutions []Resolution    `json:"verticalResolutions"`
+    AudioTracks         []AudioTrack    `json:"audioTracks"`
+    SubtitleTracks      []SubtitleTrack `json:"subtitleTracks"`
+    TrimRanges          []TimeRange     `json:"trimRanges"`
+    Cadence             FrameCadence    `json:"cadence"`
+    Chapters            []Chapter       `json:"chapters"`
+}
+
+// writeManifest is called once the subtitles have been extracted. Sidecar
+// tracks are left out, as a repackage attaches its own captions.
+func (p *Processor) writeManifest() error {
+    manifest := encodeManifest{
+        VideoInfo:           p.VideoInfo,
+        Resolutions:         p.Resolutions,
+        VerticalResolutions: p.VerticalResolutions,
+        AudioTracks:         p.AudioTracks,
+        TrimRanges:          p.TrimRanges,
+        Cadence:             p.Cadence,
+        Chapters:            p.Chapters,
+    }
+    for _, track := range p.SubtitleTracks {
+        if !track.Sidecar {
+            manifest.SubtitleTracks = append(manifest.SubtitleTracks, track)
+        }
+    }
+
+    data, err := json.MarshalIndent(manifest, "", "  ")
+    if err != nil {
+        return fmt.Errorf("failed to encode manifest: %v", err)
+    }
+    return os.WriteFile(filepath.Join(p.Paths.MP4Dir, manifestFile), data, 0644)
+}
+
+// OpenEncode returns a processor for an asset whose renditions have been
+// restored into the MP4 directory under dir, taking what it knows about the
+// source from the manifest stored with them. It has no source, so only
+// LoadMP4Files and the HLS stages can be run on it.
+func OpenEncode(dir string, config *ProcessorConfig) (*Processor, error) {
+    if config == nil {
+        config = &ProcessorConfig{}
+    }
+    if config.Profile == nil {
+        profile := DefaultProfile()
+        config.Profile = &profile
+    }
+
+    paths := newOutputPaths(dir)
+    if err := createDirectories(paths); err != nil {
+        return nil, err
+    }
+
+    data, err := os.ReadFile(filepath.Join(paths.MP4Dir, manifestFile))
+    if os.IsNotExist(err) {
+        return nil, fmt.Errorf("no %s stored with the renditions, the asset must be transcoded again", manifestFile)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to read manifest: %v", err)
+    }
+    var manifest encodeManifest
+    if err := json.Unmarshal(data, &manifest); err != nil {
+        return nil, fmt.Errorf("failed to parse manifest: %v", err)
+    }
+    if manifest.VideoInfo == nil || len(manifest.Resolutions) == 0 {
+        return nil, fmt.Errorf("manifest lists no renditions")
+    }
+
+    return &Processor{
+        Paths:       paths,
+        Resolutions: manifest.Resolutions,
+        VideoInfo:   manifest.VideoInfo,
+        Config:      config,
+        AudioTracks: manifest.AudioTracks,
+
+        SubtitleTracks:      manifest.SubtitleTracks,
+        VerticalResolutions: manifest.VerticalResolutions,
+
+        TrimRanges: manifest.TrimRanges,
+        Cadence:    manifest.Cadence,
+        Chapters:   manifest.Chapters,
+    }, nil
+}
+
+// LoadMP4Files stands in for GenerateMP4Files when the renditions of an
+// earlier run have been restored into the MP4 directory, so the HLS stages
+// can repackage them without encoding. The subtitles are extracted again
+// only when the source is at hand; otherwise the restored files are used.
+func (p *Processor) LoadMP4Files() error {
+    if p.SourcePath != "" {
+        p.extractSubtitles(p.SourcePath)
+    }
+
+    var expected []string
+    for _, res := range p.Resolutions {
+        expected = append(expected, filepath.Join(p.Paths.MP4Dir, fmt.Sprintf("%s.mp4", res.Name)))
+    }
+    for _, res := range p.VerticalResolutions {
+        expected = append(expected, p.verticalMP4(res))
+    }
+    for _, track := range p.AudioTracks {
+        expected = append(expected, filepath.Join(p.Paths.MP4Dir, track.MP4File))
+    }
+    for _, track := range p.SubtitleTracks {
+        expected = append(expected, filepath.Join(p.Paths.MP4Dir, track.VTTFile))
+    }
+
+    var missing []string
+    for _, path := range expected {
+        if _, err := os.Stat(path); err != nil {
+            missing = append(missing, filepath.Base(path))
+        }
+    }
+    if len(missing) > 0 {
+        return fmt.Errorf("missing renditions to repackage: %s", strings.Join(missing, ", "))
+    }
+    return nil
+}
\ No newline at end of file
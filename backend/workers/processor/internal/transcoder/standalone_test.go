@@ -0,0 +1,65 @@
+package transcoder
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestOpenEncodeReadsManifest(t *testing.T) {
+    dir := t.TempDir()
+    paths := newOutputPaths(dir)
+    if err := createDirectories(paths); err != nil {
+        t.Fatal(err)
+    }
+    encoded := &Processor{
+        Paths:       paths,
+        Resolutions: []Resolution{{Name: "720p", Width: 1280, Height: 720, Bitrate: "2800k"}},
+        VideoInfo:   &VideoInfo{Width: 1920, Height: 1080, Duration: 12.5, FrameRate: 25},
+        AudioTracks: []AudioTrack{{Name: "audio_eng", MP4File: "audio_eng.mp4"}},
+        SubtitleTracks: []SubtitleTrack{
+            {Name: "sub_eng", VTTFile: "subtitles_sub_eng.vtt"},
+            {Name: "sidecar_fra_1", VTTFile: "subtitles_sidecar_fra_1.vtt", Sidecar: true},
+        },
+        TrimRanges: []TimeRange{{Start: 2, End: 14.5}},
+        Cadence:    FrameCadence{OutputRate: 25},
+        Chapters:   []Chapter{{Index: 0, Start: 0, End: 12.5}},
+    }
+    if err := encoded.writeManifest(); err != nil {
+        t.Fatal(err)
+    }
+
+    p, err := OpenEncode(dir, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if p.SourcePath != "" || p.InputPath != "" {
+        t.Errorf("opened processor has a source: %q, %q", p.SourcePath, p.InputPath)
+    }
+    if p.Config.Profile == nil {
+        t.Error("opened processor has no profile")
+    }
+    if len(p.Resolutions) != 1 || p.Resolutions[0] != encoded.Resolutions[0] {
+        t.Errorf("Resolutions = %v, want %v", p.Resolutions, encoded.Resolutions)
+    }
+    if p.VideoInfo.Duration != 12.5 || p.VideoInfo.Width != 1920 {
+        t.Errorf("VideoInfo = %+v, want %+v", *p.VideoInfo, *encoded.VideoInfo)
+    }
+    if len(p.SubtitleTracks) != 1 || p.SubtitleTracks[0].Name != "sub_eng" {
+        t.Errorf("SubtitleTracks = %v, want only the embedded track", p.SubtitleTracks)
+    }
+    if len(p.TrimRanges) != 1 || p.Cadence.OutputRate != 25 || len(p.Chapters) != 1 {
+        t.Errorf("timeline not restored: %v, %+v, %v", p.TrimRanges, p.Cadence, p.Chapters)
+    }
+
+    err = p.LoadMP4Files()
+    if err == nil || !strings.Contains(err.Error(), "720p.mp4, audio_eng.mp4, subtitles_sub_eng.vtt") {
+        t.Errorf("LoadMP4Files = %v, want the missing renditions", err)
+    }
+}
+
+func TestOpenEncodeWithoutManifest(t *testing.T) {
+    _, err := OpenEncode(t.TempDir(), nil)
+    if err == nil || !strings.Contains(err.Error(), "transcoded again") {
+        t.Errorf("OpenEncode = %v, want a missing manifest error", err)
+    }
+}
\ No newline at end of file
@@ -0,0 +1,374 @@
+package transcoder
+
+import (
+    "fmt"
+    "math"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strconv"
+    "strings"
+)
+
+const (
+    subtitleGroup           = "subs"
+    subtitleSegmentDuration = 6.0
+)
+
+var textSubtitleCodecs = map[string]bool{
+    "mov_text": true,
+    "subrip":   true,
+    "srt":      true,
+    "ass":      true,
+    "ssa":      true,
+    "webvtt":   true,
+    "text":     true,
+    "eia_608":  true,
+}
+
+var srtFontTag = regexp.MustCompile(`(?i)</?font[^>]*>`)
+
+type subtitleCue struct {
+    Start    float64
+    End      float64
+    Settings string
+    Text     []string
+}
+
+func buildSubtitleTracks(streams []SubtitleStream) []SubtitleTrack {
+    tracks := make([]SubtitleTrack, 0, len(streams))
+    usedTitles := make(map[string]int)
+
+    for i, stream := range streams {
+        if !textSubtitleCodecs[stream.Codec] {
+            continue
+        }
+
+        language := normalizeLanguage(stream.Language)
+        name := fmt.Sprintf("%s_%d", language, stream.Index)
+        if stream.IsClosedCaption {
+            name = fmt.Sprintf("cc_%s", language)
+        }
+
+        title := strings.ReplaceAll(strings.TrimSpace(stream.Title), "\"", "'")
+        if title == "" {
+            title = defaultSubtitleTitle(stream, language, i)
+        }
+        usedTitles[title]++
+        if count := usedTitles[title]; count > 1 {
+            title = fmt.Sprintf("%s %d", title, count)
+        }
+
+        tracks = append(tracks, SubtitleTrack{
+            Name:        name,
+            Source:      stream,
+            Language:    language,
+            Title:       title,
+            Default:     stream.IsDefault,
+            Forced:      stream.IsForced,
+            VTTFile:     fmt.Sprintf("subtitles_%s.vtt", name),
+            PlaylistDir: filepath.Join("subtitles", name),
+        })
+    }
+
+    return tracks
+}
+
+func defaultSubtitleTitle(stream SubtitleStream, language string, position int) string {
+    if stream.IsClosedCaption {
+        return "Closed Captions"
+    }
+    if language != undeterminedLanguage {
+        return language
+    }
+    return fmt.Sprintf("Subtitles %d", position+1)
+}
+
+func parseWebVTT(data string) ([]subtitleCue, error) {
+    data = strings.TrimPrefix(data, "\ufeff")
+    data = strings.ReplaceAll(data, "\r\n", "\n")
+    blocks := strings.Split(strings.TrimSpace(data), "\n\n")
+
+    if len(blocks) == 0 || !strings.HasPrefix(blocks[0], "WEBVTT") {
+        return nil, fmt.Errorf("missing WEBVTT header")
+    }
+
+    var cues []subtitleCue
+    for i, block := range blocks[1:] {
+        lines := strings.Split(strings.Trim(block, "\n"), "\n")
+        if len(lines) == 0 || strings.HasPrefix(lines[0], "NOTE") ||
+            strings.HasPrefix(lines[0], "STYLE") || strings.HasPrefix(lines[0], "REGION") {
+            continue
+        }
+
+        // Cue identifiers are optional and precede the timing line.
+        if !strings.Contains(lines[0], "-->") {
+            lines = lines[1:]
+        }
+        if len(lines) == 0 || !strings.Contains(lines[0], "-->") {
+            return nil, fmt.Errorf("cue %d: missing timing line", i+1)
+        }
+
+        cue, err := parseCueTiming(lines[0])
+        if err != nil {
+            return nil, fmt.Errorf("cue %d: %v", i+1, err)
+        }
+        cue.Text = lines[1:]
+        cues = append(cues, cue)
+    }
+
+    return cues, nil
+}
+
+func parseCueTiming(line string) (subtitleCue, error) {
+    parts := strings.SplitN(line, "-->", 2)
+    if len(parts) != 2 {
+        return subtitleCue{}, fmt.Errorf("invalid cue timing %q", line)
+    }
+
+    fields := strings.Fields(parts[1])
+    if len(fields) == 0 {
+        return subtitleCue{}, fmt.Errorf("invalid cue timing %q", line)
+    }
+
+    start, err := parseCueTimestamp(parts[0])
+    if err != nil {
+        return subtitleCue{}, err
+    }
+    end, err := parseCueTimestamp(fields[0])
+    if err != nil {
+        return subtitleCue{}, err
+    }
+    if end < start {
+        return subtitleCue{}, fmt.Errorf("cue ends before it starts %q", line)
+    }
+
+    return subtitleCue{
+        Start:    start,
+        End:      end,
+        Settings: strings.Join(fields[1:], " "),
+    }, nil
+}
+
+func parseCueTimestamp(value string) (float64, error) {
+    value = strings.ReplaceAll(strings.TrimSpace(value), ",", ".")
+    parts := strings.Split(value, ":")
+    if len(parts) < 2 || len(parts) > 3 {
+        return 0, fmt.Errorf("invalid timestamp %q", value)
+    }
+
+    seconds, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+    if err != nil {
+        return 0, fmt.Errorf("invalid timestamp %q", value)
+    }
+
+    multiplier := 60.0
+    for i := len(parts) - 2; i >= 0; i-- {
+        unit, err := strconv.Atoi(parts[i])
+        if err != nil {
+            return 0, fmt.Errorf("invalid timestamp %q", value)
+        }
+        seconds += float64(unit) * multiplier
+        multiplier *= 60
+    }
+
+    return seconds, nil
+}
+
+func formatCueTimestamp(seconds float64) string {
+    millis := int64(math.Round(seconds * 1000))
+    if millis < 0 {
+        millis = 0
+    }
+    return fmt.Sprintf("%02d:%02d:%02d.%03d",
+        millis/3600000, (millis/60000)%60, (millis/1000)%60, millis%1000)
+}
+
+func formatCue(cue subtitleCue) string {
+    timing := fmt.Sprintf("%s --> %s", formatCueTimestamp(cue.Start), formatCueTimestamp(cue.End))
+    if cue.Settings != "" {
+        timing += " " + cue.Settings
+    }
+    return timing + "\n" + strings.Join(cue.Text, "\n")
+}
+
+func writeWebVTT(path string, cues []subtitleCue) error {
+    blocks := []string{"WEBVTT"}
+    for _, cue := range cues {
+        blocks = append(blocks, formatCue(cue))
+    }
+    return os.WriteFile(path, []byte(strings.Join(blocks, "\n\n")+"\n"), 0644)
+}
+
+// Cues that straddle a segment boundary are repeated in every segment they
+// overlap, as HLS clients only render cues from the segments they fetch.
+func writeSegmentedWebVTT(cues []subtitleCue, dir string, duration float64) error {
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return fmt.Errorf("failed to create subtitle directory: %v", err)
+    }
+
+    segmentCount := int(math.Ceil(duration / subtitleSegmentDuration))
+    if segmentCount < 1 {
+        segmentCount = 1
+    }
+
+    playlist := []string{
+        "#EXTM3U",
+        "#EXT-X-VERSION:6",
+        fmt.Sprintf("#EXT-X-TARGETDURATION:%d", int(subtitleSegmentDuration)),
+        "#EXT-X-MEDIA-SEQUENCE:0",
+        "#EXT-X-PLAYLIST-TYPE:VOD",
+    }
+
+    for i := 0; i < segmentCount; i++ {
+        start := float64(i) * subtitleSegmentDuration
+        end := math.Min(start+subtitleSegmentDuration, duration)
+        if i == segmentCount-1 && end <= start {
+            end = start + subtitleSegmentDuration
+        }
+
+        var segmentCues []subtitleCue
+        for _, cue := range cues {
+            if cue.End > start && cue.Start < end {
+                segmentCues = append(segmentCues, cue)
+            }
+        }
+
+        segmentFile := fmt.Sprintf("data%03d.vtt", i)
+        if err := writeWebVTT(filepath.Join(dir, segmentFile), segmentCues); err != nil {
+            return fmt.Errorf("failed to write subtitle segment: %v", err)
+        }
+
+        playlist = append(playlist,
+            fmt.Sprintf("#EXTINF:%.3f,", end-start),
+            segmentFile)
+    }
+
+    playlist = append(playlist, "#EXT-X-ENDLIST")
+    return os.WriteFile(filepath.Join(dir, "stream.m3u8"), []byte(strings.Join(playlist, "\n")+"\n"), 0644)
+}
+
+func escapeFilterPath(path string) string {
+    return strings.NewReplacer(
+        `\`, `\\\\`,
+        `'`, `\\\'`,
+        `:`, `\\:`,
+        `,`, `\,`,
+        `[`, `\[`,
+        `]`, `\]`,
+        `;`, `\;`,
+    ).Replace(path)
+}
+
+func (p *Processor) AddSidecarSubtitle(sidecar SidecarSubtitle) error {
+    data, err := os.ReadFile(sidecar.Path)
+    if err != nil {
+        return fmt.Errorf("failed to read caption file: %v", err)
+    }
+
+    var cues []subtitleCue
+    text := strings.TrimPrefix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\ufeff")
+    if strings.HasPrefix(strings.TrimSpace(text), "WEBVTT") {
+        cues, err = parseWebVTT(text)
+    } else {
+        cues, err = parseSRT(text)
+    }
+    if err != nil {
+        return err
+    }
+    if len(cues) == 0 {
+        return fmt.Errorf("caption file contains no cues")
+    }
+
+    cues = p.retimeCues(cues, sidecar.Offset)
+
+    language := normalizeLanguage(sidecar.Language)
+    name := fmt.Sprintf("sidecar_%s_%d", language, len(p.SubtitleTracks))
+    title := strings.ReplaceAll(strings.TrimSpace(sidecar.Label), "\"", "'")
+    if title == "" {
+        title = language
+    }
+    for _, existing := range p.SubtitleTracks {
+        if existing.Title == title {
+            title = fmt.Sprintf("%s %d", title, len(p.SubtitleTracks)+1)
+            break
+        }
+    }
+
+    track := SubtitleTrack{
+        Name:        name,
+        Source:      SubtitleStream{Index: -1, Codec: "webvtt", Language: language},
+        Language:    language,
+        Title:       title,
+        Sidecar:     true,
+        VTTFile:     fmt.Sprintf("subtitles_%s.vtt", name),
+        PlaylistDir: filepath.Join("subtitles", name),
+    }
+
+    if err := writeWebVTT(filepath.Join(p.Paths.MP4Dir, track.VTTFile), cues); err != nil {
+        return fmt.Errorf("failed to write converted captions: %v", err)
+    }
+
+    p.SubtitleTracks = append(p.SubtitleTracks, track)
+    return nil
+}
+
+// retimeCues moves sidecar cues onto the output timeline and drops the ones
+// that fall entirely outside it. Sidecar timings refer to the uploaded source,
+// so they follow the same trim as the media.
+func (p *Processor) retimeCues(cues []subtitleCue, offset float64) []subtitleCue {
+    shifted := make([]subtitleCue, 0, len(cues))
+    for _, cue := range cues {
+        cue.Start += offset
+        cue.End += offset
+        shifted = append(shifted, cue)
+    }
+
+    retimed := make([]subtitleCue, 0, len(cues))
+    for _, cue := range p.trimCues(shifted) {
+        if cue.End <= 0 || (p.VideoInfo.Duration > 0 && cue.Start >= p.VideoInfo.Duration) {
+            continue
+        }
+        cue.Start = math.Max(cue.Start, 0)
+        if p.VideoInfo.Duration > 0 {
+            cue.End = math.Min(cue.End, p.VideoInfo.Duration)
+        }
+        retimed = append(retimed, cue)
+    }
+    return retimed
+}
+
+func parseSRT(data string) ([]subtitleCue, error) {
+    blocks := strings.Split(strings.TrimSpace(data), "\n\n")
+
+    var cues []subtitleCue
+    for i, block := range blocks {
+        lines := strings.Split(strings.Trim(block, "\n"), "\n")
+        if len(lines) == 1 && strings.TrimSpace(lines[0]) == "" {
+            continue
+        }
+
+        if !strings.Contains(lines[0], "-->") {
+            if _, err := strconv.Atoi(strings.TrimSpace(lines[0])); err != nil {
+                return nil, fmt.Errorf("cue %d: expected sequence number, got %q", i+1, lines[0])
+            }
+            lines = lines[1:]
+        }
+        if len(lines) == 0 || !strings.Contains(lines[0], "-->") {
+            return nil, fmt.Errorf("cue %d: missing timing line", i+1)
+        }
+
+        cue, err := parseCueTiming(lines[0])
+        if err != nil {
+            return nil, fmt.Errorf("cue %d: %v", i+1, err)
+        }
+        // SRT positioning hints have no WebVTT equivalent.
+        cue.Settings = ""
+        for _, line := range lines[1:] {
+            cue.Text = append(cue.Text, srtFontTag.ReplaceAllString(line, ""))
+        }
+        cues = append(cues, cue)
+    }
+
+    return cues, nil
+}
@@ -0,0 +1,136 @@
+package transcoder
+
+import (
+    "fmt"
+    "math"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// normalizeTrimRanges clamps the requested ranges to the source and rejects
+// overlapping or out of order ranges. An End of 0 keeps everything after Start.
+func normalizeTrimRanges(ranges []TimeRange, duration float64) ([]TimeRange, error) {
+    normalized := make([]TimeRange, 0, len(ranges))
+    for i, r := range ranges {
+        if r.Start < 0 || r.End < 0 {
+            return nil, fmt.Errorf("trim range %d: times must not be negative", i+1)
+        }
+        if r.End == 0 || (duration > 0 && r.End > duration) {
+            r.End = duration
+        }
+        if r.End <= r.Start {
+            return nil, fmt.Errorf("trim range %d: end must be after start", i+1)
+        }
+        if len(normalized) > 0 && r.Start < normalized[len(normalized)-1].End {
+            return nil, fmt.Errorf("trim range %d: ranges must be in order and not overlap", i+1)
+        }
+        normalized = append(normalized, r)
+    }
+    return normalized, nil
+}
+
+// applyTrim re-encodes the kept ranges into an intermediate file that replaces
+// InputPath, so every later stage works on the trimmed timeline. Frames are cut
+// with trim/atrim rather than input seeking to stay accurate off keyframes.
+func (p *Processor) applyTrim() error {
+    ranges, err := normalizeTrimRanges(p.Config.Trim, p.VideoInfo.Duration)
+    if err != nil {
+        return err
+    }
+    if len(ranges) == 0 {
+        return nil
+    }
+
+    audioCount := len(p.VideoInfo.AudioStreams)
+    var filters, concatInputs []string
+    for i, r := range ranges {
+        filters = append(filters, fmt.Sprintf("[0:v:0]trim=start=%.3f:end=%.3f,setpts=PTS-STARTPTS[v%d]", r.Start, r.End, i))
+        concatInputs = append(concatInputs, fmt.Sprintf("[v%d]", i))
+        for a := 0; a < audioCount; a++ {
+            filters = append(filters, fmt.Sprintf("[0:a:%d]atrim=start=%.3f:end=%.3f,asetpts=PTS-STARTPTS[a%d_%d]", a, r.Start, r.End, a, i))
+            concatInputs = append(concatInputs, fmt.Sprintf("[a%d_%d]", a, i))
+        }
+    }
+
+    outputs := []string{"[v]"}
+    for a := 0; a < audioCount; a++ {
+        outputs = append(outputs, fmt.Sprintf("[a%d]", a))
+    }
+    filters = append(filters, fmt.Sprintf("%sconcat=n=%d:v=1:a=%d%s",
+        strings.Join(concatInputs, ""), len(ranges), audioCount, strings.Join(outputs, "")))
+
+    trimmedPath := filepath.Join(filepath.Dir(p.InputPath), "trimmed.mkv")
+    args := []string{
+        "-v", "error",
+        "-i", p.InputPath,
+        "-filter_complex", strings.Join(filters, ";"),
+    }
+    for _, output := range outputs {
+        args = append(args, "-map", output)
+    }
+    // The intermediate is encoded near-lossless since the ladder encodes it again.
+    args = append(args,
+        "-c:v", "libx264",
+        "-preset", "veryfast",
+        "-crf", "12",
+        "-pix_fmt", "yuv420p",
+        "-c:a", "flac",
+        "-y",
+        trimmedPath,
+    )
+
+    if err := runFFmpeg(args); err != nil {
+        return fmt.Errorf("trim failed: %v", err)
+    }
+
+    duration := 0.0
+    for _, r := range ranges {
+        duration += r.End - r.Start
+    }
+
+    p.SourcePath = p.InputPath
+    p.InputPath = trimmedPath
+    p.VideoInfo.Duration = duration
+    p.TrimRanges = ranges
+    return nil
+}
+
+// trimCues moves cues from the source timeline onto the trimmed one. A cue
+// that spans a cut is shortened to the part that survives it.
+func (p *Processor) trimCues(cues []subtitleCue) []subtitleCue {
+    if len(p.TrimRanges) == 0 {
+        return cues
+    }
+
+    trimmed := make([]subtitleCue, 0, len(cues))
+    for _, cue := range cues {
+        start, end := math.Inf(1), math.Inf(-1)
+        offset := 0.0
+        for _, r := range p.TrimRanges {
+            if cue.End > r.Start && cue.Start < r.End {
+                start = math.Min(start, offset+math.Max(cue.Start, r.Start)-r.Start)
+                end = math.Max(end, offset+math.Min(cue.End, r.End)-r.Start)
+            }
+            offset += r.End - r.Start
+        }
+        if end <= start {
+            continue
+        }
+        cue.Start, cue.End = start, end
+        trimmed = append(trimmed, cue)
+    }
+    return trimmed
+}
+
+func (p *Processor) trimSubtitleFile(path string) error {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return err
+    }
+    cues, err := parseWebVTT(string(data))
+    if err != nil {
+        return err
+    }
+    return writeWebVTT(path, p.trimCues(cues))
+}
\ No newline at end of file
@@ -0,0 +1,163 @@
+package transcoder
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+)
+
+// ValidateHLSOutput checks that every playlist under the HLS directory only
+// references files that exist, and that every byte range, whether of a
+// segment, a low-latency part or a preload hint, stays inside its file, so
+// broken output in both the segmented and single-file layouts is caught
+// before upload rather than by players.
+func (p *Processor) ValidateHLSOutput() error {
+    var playlists []string
+    err := filepath.Walk(p.Paths.HLSDir, func(path string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if !info.IsDir() && filepath.Ext(path) == ".m3u8" {
+            playlists = append(playlists, path)
+        }
+        return nil
+    })
+    if err != nil {
+        return fmt.Errorf("failed to list playlists: %v", err)
+    }
+
+    var problems []string
+    for _, playlist := range playlists {
+        problems = append(problems, validatePlaylist(playlist)...)
+    }
+    if len(problems) > 0 {
+        return fmt.Errorf("invalid HLS output (%d): %s", len(problems), strings.Join(problems, "; "))
+    }
+    return nil
+}
+
+func validatePlaylist(playlist string) []string {
+    data, err := os.ReadFile(playlist)
+    if err != nil {
+        return []string{fmt.Sprintf("%s: %v", playlist, err)}
+    }
+
+    name := filepath.Base(filepath.Dir(playlist)) + "/" + filepath.Base(playlist)
+    dir := filepath.Dir(playlist)
+    sizes := make(map[string]int64)
+    var problems []string
+
+    // check resolves a reference and, when a range is given, its bounds.
+    check := func(uri string, length, offset int64) {
+        if uri == "" || strings.Contains(uri, "://") {
+            return
+        }
+        path := filepath.Join(dir, filepath.FromSlash(uri))
+        size, ok := sizes[path]
+        if !ok {
+            info, err := os.Stat(path)
+            if err != nil {
+                problems = append(problems, fmt.Sprintf("%s: missing %s", name, uri))
+                sizes[path] = -1
+                return
+            }
+            size = info.Size()
+            sizes[path] = size
+        }
+        if size >= 0 && length >= 0 && offset+length > size {
+            problems = append(problems, fmt.Sprintf("%s: range %d@%d outside %s (%d bytes)", name, length, offset, uri, size))
+        }
+    }
+
+    // A BYTERANGE without an offset continues where the previous range of the
+    // same file ended. Parts keep their own positions, as they subdivide the
+    // segments that follow them.
+    ends := make(map[string]int64)
+    partEnds := make(map[string]int64)
+    length, offset := int64(-1), int64(-1)
+    for _, line := range strings.Split(string(data), "\n") {
+        line = strings.TrimSpace(line)
+        switch {
+        case line == "":
+        case strings.HasPrefix(line, "#EXT-X-BYTERANGE:"):
+            var err error
+            length, offset, err = parseByteRange(strings.TrimPrefix(line, "#EXT-X-BYTERANGE:"))
+            if err != nil {
+                problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+            }
+        case strings.HasPrefix(line, "#EXT-X-MAP:"):
+            mapLength, mapOffset := int64(-1), int64(0)
+            if value := playlistAttribute(line, "BYTERANGE"); value != "" {
+                var err error
+                if mapLength, mapOffset, err = parseByteRange(value); err != nil {
+                    problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+                }
+                if mapOffset < 0 {
+                    mapOffset = 0
+                }
+            }
+            check(playlistAttribute(line, "URI"), mapLength, mapOffset)
+        case strings.HasPrefix(line, "#EXT-X-PART:"):
+            uri := playlistAttribute(line, "URI")
+            partLength, partOffset := int64(-1), int64(0)
+            if value := playlistAttribute(line, "BYTERANGE"); value != "" {
+                var err error
+                if partLength, partOffset, err = parseByteRange(value); err != nil {
+                    problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+                }
+                if partOffset < 0 {
+                    partOffset = partEnds[uri]
+                }
+                partEnds[uri] = partOffset + partLength
+            }
+            check(uri, partLength, partOffset)
+        case strings.HasPrefix(line, "#EXT-X-PRELOAD-HINT:"):
+            // The hinted bytes may still be in flight, so only the start has
+            // to be inside the file unless a length is announced.
+            hintLength, hintStart := int64(0), int64(0)
+            for attribute, target := range map[string]*int64{"BYTERANGE-START": &hintStart, "BYTERANGE-LENGTH": &hintLength} {
+                if value := playlistAttribute(line, attribute); value != "" {
+                    parsed, err := strconv.ParseInt(value, 10, 64)
+                    if err != nil || parsed < 0 {
+                        problems = append(problems, fmt.Sprintf("%s: invalid %s %q", name, attribute, value))
+                        continue
+                    }
+                    *target = parsed
+                }
+            }
+            check(playlistAttribute(line, "URI"), hintLength, hintStart)
+        case strings.HasPrefix(line, "#EXT-X-MEDIA:"), strings.HasPrefix(line, "#EXT-X-I-FRAME-STREAM-INF:"):
+            check(playlistAttribute(line, "URI"), -1, 0)
+        case strings.HasPrefix(line, "#"):
+        default:
+            if length >= 0 {
+                if offset < 0 {
+                    offset = ends[line]
+                }
+                ends[line] = offset + length
+            }
+            check(line, length, offset)
+            length, offset = -1, -1
+        }
+    }
+    return problems
+}
+
+// parseByteRange reads "length[@offset]"; a missing offset is returned as -1.
+func parseByteRange(value string) (int64, int64, error) {
+    lengthPart, offsetPart, hasOffset := strings.Cut(value, "@")
+    length, err := strconv.ParseInt(lengthPart, 10, 64)
+    if err != nil {
+        return -1, -1, fmt.Errorf("invalid byte range %q", value)
+    }
+    if !hasOffset {
+        return length, -1, nil
+    }
+    offset, err := strconv.ParseInt(offsetPart, 10, 64)
+    if err != nil {
+        return -1, -1, fmt.Errorf("invalid byte range %q", value)
+    }
+    return length, offset, nil
+}
\ No newline at end of file
@@ -0,0 +1,70 @@
+package transcoder
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func writePlaylist(t *testing.T, dir, content string) string {
+    t.Helper()
+    if err := os.WriteFile(filepath.Join(dir, "data000.m4s"), make([]byte, 1000), 0644); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.WriteFile(filepath.Join(dir, "init.mp4"), make([]byte, 100), 0644); err != nil {
+        t.Fatal(err)
+    }
+    playlist := filepath.Join(dir, "stream.m3u8")
+    if err := os.WriteFile(playlist, []byte(content), 0644); err != nil {
+        t.Fatal(err)
+    }
+    return playlist
+}
+
+func TestValidatePlaylistParts(t *testing.T) {
+    tests := []struct {
+        name    string
+        lines   []string
+        problem string
+    }{
+        {
+            name: "parts inside segment",
+            lines: []string{
+                `#EXT-X-PART:DURATION=0.5,URI="data000.m4s",BYTERANGE="400@0",INDEPENDENT=YES`,
+                `#EXT-X-PART:DURATION=0.5,URI="data000.m4s",BYTERANGE="600"`,
+                `#EXTINF:1.0,`, `data000.m4s`,
+                `#EXT-X-PRELOAD-HINT:TYPE=PART,URI="data000.m4s",BYTERANGE-START=1000`,
+            },
+        },
+        {
+            name: "implicit offset runs past the end",
+            lines: []string{
+                `#EXT-X-PART:DURATION=0.5,URI="data000.m4s",BYTERANGE="600@0"`,
+                `#EXT-X-PART:DURATION=0.5,URI="data000.m4s",BYTERANGE="600"`,
+            },
+            problem: "range 600@600",
+        },
+        {
+            name:    "missing part file",
+            lines:   []string{`#EXT-X-PART:DURATION=0.5,URI="data001.m4s"`},
+            problem: "missing data001.m4s",
+        },
+        {
+            name:    "hint past the end",
+            lines:   []string{`#EXT-X-PRELOAD-HINT:TYPE=PART,URI="data000.m4s",BYTERANGE-START=900,BYTERANGE-LENGTH=200`},
+            problem: "range 200@900",
+        },
+    }
+
+    for _, test := range tests {
+        content := "#EXTM3U\n#EXT-X-MAP:URI=\"init.mp4\"\n" + strings.Join(test.lines, "\n") + "\n"
+        problems := validatePlaylist(writePlaylist(t, t.TempDir(), content))
+        switch {
+        case test.problem == "" && len(problems) > 0:
+            t.Errorf("%s: unexpected problems %v", test.name, problems)
+        case test.problem != "" && (len(problems) != 1 || !strings.Contains(problems[0], test.problem)):
+            t.Errorf("%s: got %v, want one problem containing %q", test.name, problems, test.problem)
+        }
+    }
+}
\ No newline at end of file
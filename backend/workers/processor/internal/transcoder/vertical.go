@@ -0,0 +1,255 @@
+package transcoder
+
+import (
+    "bufio"
+    "context"
+    "fmt"
+    "io"
+    "log"
+    "math"
+    "os"
+    "os/exec"
+    "path/filepath"
+)
+
+const (
+    VerticalCenter = "center"
+    VerticalSmart  = "smart"
+    VerticalFill   = "fill"
+
+    verticalDir = "vertical"
+
+    saliencyWidth  = 192
+    saliencyHeight = 108
+    saliencyFPS    = 4
+    // A window needs this much mean frame difference per pixel before it is
+    // allowed to move the crop; below it the previous position is kept.
+    saliencyMinEnergy = 1.0
+)
+
+// prepareVertical derives a 9:16 rendition set from the landscape ladder.
+// Sources that are already vertical are published as they are.
+func (p *Processor) prepareVertical() error {
+    switch p.Config.Vertical {
+    case "":
+        return nil
+    case VerticalCenter, VerticalSmart, VerticalFill:
+    default:
+        return fmt.Errorf("unknown vertical mode: %s", p.Config.Vertical)
+    }
+
+    if p.VideoInfo.IsVertical {
+        log.Printf("Source is already vertical, skipping vertical renditions")
+        return nil
+    }
+
+    for _, res := range p.Resolutions {
+        p.VerticalResolutions = append(p.VerticalResolutions, Resolution{
+            Name:    res.Name,
+            Width:   res.Height,
+            Height:  res.Width,
+            Bitrate:     res.Bitrate,
+            RateControl: res.RateControl,
+            CRF:         res.CRF,
+        })
+    }
+    return nil
+}
+
+func (p *Processor) verticalMP4(res Resolution) string {
+    return filepath.Join(p.Paths.MP4Dir, fmt.Sprintf("%s_%s.mp4", verticalDir, res.Name))
+}
+
+func (p *Processor) verticalStreamDir(res Resolution) string {
+    return filepath.Join(p.Paths.HLSDir, verticalDir, "video", res.Name)
+}
+
+// verticalCropWidth is the widest 9:16 window the source height allows.
+func (p *Processor) verticalCropWidth() int {
+    width := int(math.Round(float64(p.VideoInfo.Height)*9/16/2)) * 2
+    if width > p.VideoInfo.Width {
+        width = p.VideoInfo.Width / 2 * 2
+    }
+    return width
+}
+
+// prepareSmartCrop analyses motion once for all vertical renditions, before
+// they are encoded concurrently.
+func (p *Processor) prepareSmartCrop() {
+    if p.Config.Vertical == VerticalSmart && len(p.VerticalResolutions) > 0 && p.verticalCropX == "" {
+        p.verticalCropX = p.smartCropExpression(p.verticalCropWidth())
+    }
+}
+
+func (p *Processor) generateVerticalMP4(ctx context.Context, inputPath string, res Resolution, threads int) error {
+    inputs, filter := p.verticalFilter(res)
+    args := append([]string{
+        "-v", "error",
+        "-i", inputPath,
+    }, inputs...)
+    args = append(args, filter...)
+
+    err := runPasses(ctx, encodePasses(res, p.passLog(verticalDir+"_"+res.Name)), func(pass encodePass) []string {
+        return append(args[:len(args):len(args)], p.videoEncodeArgs(res, p.verticalMP4(res), threads, pass)...)
+    })
+    if err != nil {
+        return fmt.Errorf("vertical rendition %s failed: %w", res.Name, err)
+    }
+    return nil
+}
+
+// verticalFilter returns the inputs that follow the source and the filter
+// options that reframe it into one vertical rendition.
+func (p *Processor) verticalFilter(res Resolution) ([]string, []string) {
+    base := p.cadenceFilter() + p.cropFilter()
+    cropWidth := p.verticalCropWidth()
+
+    var graph string
+    switch p.Config.Vertical {
+    case VerticalFill:
+        graph = fmt.Sprintf("[0:v]%ssplit[bgsrc][fgsrc];"+
+            "[bgsrc]scale=%d:%d:force_original_aspect_ratio=increase,crop=%d:%d,boxblur=20:2[bg];"+
+            "[fgsrc]scale=%d:-2[fg];"+
+            "[bg][fg]overlay=(W-w)/2:(H-h)/2,setsar=1[vbase]",
+            base, res.Width, res.Height, res.Width, res.Height, res.Width)
+    case VerticalSmart:
+        graph = fmt.Sprintf("[0:v]%scrop=%d:ih:x='%s':y=0,scale=%d:%d,setsar=1[vbase]",
+            base, cropWidth, p.verticalCropX, res.Width, res.Height)
+    default:
+        graph = fmt.Sprintf("[0:v]%scrop=%d:ih:(iw-ow)/2:0,scale=%d:%d,setsar=1[vbase]",
+            base, cropWidth, res.Width, res.Height)
+    }
+
+    if p.Config.Watermark != nil {
+        return []string{"-i", p.Config.Watermark.ImagePath},
+            []string{"-filter_complex", graph + ";" + p.watermarkOverlay("1:v", "vbase", "v", res.Height), "-map", "[v]"}
+    }
+    return nil, []string{"-filter_complex", graph + ";[vbase]format=yuv420p[v]", "-map", "[v]"}
+}
+
+// smartCropExpression follows the action with a crop window. ffmpeg renders
+// a small grayscale frame-difference stream (tblend), and for each time
+// window the crop is centred on the columns with the most motion. The window
+// centres are smoothed and linearly interpolated so the crop pans rather than
+// jumps. Any failure falls back to a centred crop.
+func (p *Processor) smartCropExpression(cropWidth int) string {
+    center := fmt.Sprintf("%d", (p.VideoInfo.Width-cropWidth)/2)
+
+    windowSeconds := math.Max(2, p.VideoInfo.Duration/40)
+    framesPerWindow := int(windowSeconds * saliencyFPS)
+    cropColumns := int(math.Round(float64(cropWidth) * saliencyWidth / float64(p.VideoInfo.Width)))
+    if cropColumns < 1 || cropColumns >= saliencyWidth {
+        return center
+    }
+
+    filter := fmt.Sprintf("%s%sfps=%d,scale=%d:%d,format=gray,tblend=all_mode=difference",
+        p.cadenceFilter(), p.cropFilter(), saliencyFPS, saliencyWidth, saliencyHeight)
+    cmd := exec.Command("ffmpeg",
+        "-v", "error",
+        "-i", p.InputPath,
+        "-an",
+        "-vf", filter,
+        "-f", "rawvideo",
+        "-pix_fmt", "gray",
+        "-")
+    cmd.Stderr = os.Stderr
+    stdout, err := cmd.StdoutPipe()
+    if err == nil {
+        err = cmd.Start()
+    }
+    if err != nil {
+        log.Printf("Motion analysis failed, using centre crop: %v", err)
+        return center
+    }
+
+    // Frames are read one at a time and only the column sums of the current
+    // window are kept, as the whole stream would not fit in memory for long
+    // sources.
+    var centers []float64
+    previous := float64(saliencyWidth) / 2
+    columns := make([]float64, saliencyWidth)
+    total, frames := 0.0, 0
+    finishWindow := func() {
+        if total/float64(frames*saliencyWidth*saliencyHeight) >= saliencyMinEnergy {
+            best, sum := 0, 0.0
+            for x := 0; x < cropColumns; x++ {
+                sum += columns[x]
+            }
+            bestSum := sum
+            for x := 1; x+cropColumns <= saliencyWidth; x++ {
+                sum += columns[x+cropColumns-1] - columns[x-1]
+                if sum > bestSum {
+                    best, bestSum = x, sum
+                }
+            }
+            previous = float64(best) + float64(cropColumns)/2
+        }
+        centers = append(centers, previous)
+
+        clear(columns)
+        total, frames = 0, 0
+    }
+
+    reader := bufio.NewReader(stdout)
+    frame := make([]byte, saliencyWidth*saliencyHeight)
+    for {
+        // A trailing partial frame is dropped.
+        if _, err = io.ReadFull(reader, frame); err != nil {
+            break
+        }
+        for y := 0; y < saliencyHeight; y++ {
+            row := frame[y*saliencyWidth : (y+1)*saliencyWidth]
+            for x, value := range row {
+                columns[x] += float64(value)
+                total += float64(value)
+            }
+        }
+        frames++
+        if frames == framesPerWindow {
+            finishWindow()
+        }
+    }
+    if err != io.EOF && err != io.ErrUnexpectedEOF {
+        cmd.Process.Kill()
+    }
+    if waitErr := cmd.Wait(); waitErr != nil {
+        log.Printf("Motion analysis failed, using centre crop: %v", waitErr)
+        return center
+    }
+    if frames > 0 {
+        finishWindow()
+    }
+    if len(centers) == 0 {
+        return center
+    }
+
+    scale := float64(p.VideoInfo.Width) / saliencyWidth
+    offsets := make([]int, len(centers))
+    for i := range centers {
+        sum, count := 0.0, 0
+        for j := i - 1; j <= i+1; j++ {
+            if j >= 0 && j < len(centers) {
+                sum += centers[j]
+                count++
+            }
+        }
+        left := sum/float64(count)*scale - float64(cropWidth)/2
+        left = math.Max(0, math.Min(left, float64(p.VideoInfo.Width-cropWidth)))
+        offsets[i] = int(left) / 2 * 2
+    }
+
+    // Nested from the last window outwards: each segment interpolates from
+    // its window's midpoint to the next one's.
+    expression := fmt.Sprintf("%d", offsets[len(offsets)-1])
+    for i := len(offsets) - 2; i >= 0; i-- {
+        from := (float64(i) + 0.5) * windowSeconds
+        expression = fmt.Sprintf("if(lt(t,%.3f),%d+(%d)*(max(t,%.3f)-%.3f)/%.3f,%s)",
+            from+windowSeconds, offsets[i], offsets[i+1]-offsets[i], from, from, windowSeconds, expression)
+    }
+    return expression
+}
+
+func (p *Processor) generateVerticalMaster() error {
+    masterFile := filepath.Join(p.Paths.HLSDir, verticalDir, "master.m3u8")
+    return os.WriteFile(masterFile, []byte(p.buildMasterPlaylist(p.VerticalResolutions, "../", false)), 0644)
+}
\ No newline at end of file
@@ -0,0 +1,102 @@
+package transcoder
+
+import (
+    "fmt"
+    "math"
+)
+
+const (
+    WatermarkTopLeft     = "top-left"
+    WatermarkTopRight    = "top-right"
+    WatermarkBottomLeft  = "bottom-left"
+    WatermarkBottomRight = "bottom-right"
+    WatermarkCenter      = "center"
+)
+
+func (w *Watermark) Validate() error {
+    if w.ImagePath == "" {
+        return fmt.Errorf("watermark image is required")
+    }
+    switch w.Position {
+    case "", WatermarkTopLeft, WatermarkTopRight, WatermarkBottomLeft, WatermarkBottomRight, WatermarkCenter:
+    default:
+        return fmt.Errorf("unknown watermark position: %s", w.Position)
+    }
+    if w.Opacity < 0 || w.Opacity > 1 {
+        return fmt.Errorf("watermark opacity must be between 0 and 1")
+    }
+    if w.Scale < 0 || w.Scale > 1 {
+        return fmt.Errorf("watermark scale must be between 0 and 1")
+    }
+    if w.Margin < 0 || w.Margin > 0.5 {
+        return fmt.Errorf("watermark margin must be between 0 and 0.5")
+    }
+    if w.End > 0 && w.End <= w.Start {
+        return fmt.Errorf("watermark end must be after its start")
+    }
+    return nil
+}
+
+// outputHeight mirrors ladderScale, which fixes one side of the rendition and
+// lets ffmpeg derive the other.
+func (p *Processor) outputHeight(res Resolution) int {
+    if p.VideoInfo.IsVertical || p.VideoInfo.Width == 0 {
+        return res.Height
+    }
+    height := float64(res.Width) * float64(p.VideoInfo.Height) / float64(p.VideoInfo.Width)
+    return int(math.Round(height/2)) * 2
+}
+
+// watermarkFilter overlays the logo on an already scaled frame so its size and
+// margin follow each rendition's height. The graph expects the source on input
+// 0, the image on input 1, and produces [v].
+func (p *Processor) watermarkFilter(scaleFilter string, res Resolution) string {
+    return fmt.Sprintf("[0:v]%s[base];%s", scaleFilter, p.watermarkOverlay("1:v", "base", "v", p.outputHeight(res)))
+}
+
+// watermarkOverlay scales the logo from the logo label onto the frames of the
+// base label and outputs them as the output label.
+func (p *Processor) watermarkOverlay(logo, base, output string, height int) string {
+    w := p.Config.Watermark
+
+    scale := w.Scale
+    if scale == 0 {
+        scale = 0.1
+    }
+    opacity := w.Opacity
+    if opacity == 0 {
+        opacity = 0.8
+    }
+    margin := w.Margin
+    if margin == 0 {
+        margin = 0.03
+    }
+
+    logoHeight := int(math.Max(2, math.Round(float64(height)*scale/2)*2))
+    marginPx := int(math.Round(float64(height) * margin))
+
+    var x, y string
+    switch w.Position {
+    case WatermarkTopLeft:
+        x, y = fmt.Sprintf("%d", marginPx), fmt.Sprintf("%d", marginPx)
+    case WatermarkBottomLeft:
+        x, y = fmt.Sprintf("%d", marginPx), fmt.Sprintf("H-h-%d", marginPx)
+    case WatermarkTopRight:
+        x, y = fmt.Sprintf("W-w-%d", marginPx), fmt.Sprintf("%d", marginPx)
+    case WatermarkCenter:
+        x, y = "(W-w)/2", "(H-h)/2"
+    default:
+        x, y = fmt.Sprintf("W-w-%d", marginPx), fmt.Sprintf("H-h-%d", marginPx)
+    }
+
+    overlay := fmt.Sprintf("overlay=x=%s:y=%s", x, y)
+    if w.End > 0 {
+        overlay += fmt.Sprintf(":enable='between(t,%.3f,%.3f)'", w.Start, w.End)
+    } else if w.Start > 0 {
+        overlay += fmt.Sprintf(":enable='gte(t,%.3f)'", w.Start)
+    }
+
+    return fmt.Sprintf("[%s]format=rgba,colorchannelmixer=aa=%.2f,scale=-2:%d[%swm];"+
+        "[%s][%swm]%s,format=yuv420p[%s]",
+        logo, opacity, logoHeight, output, base, output, overlay, output)
+}
\ No newline at end of file